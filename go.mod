@@ -4,7 +4,9 @@ go 1.23.5
 
 require (
 	github.com/antchfx/jsonquery v1.3.6
+	github.com/antchfx/xmlquery v1.5.1
 	github.com/cucumber/godog v0.15.0
+	github.com/cucumber/messages/go/v21 v21.0.1
 	github.com/go-faker/faker/v4 v4.6.0
 	github.com/jinzhu/now v1.1.5
 	github.com/joho/godotenv v1.5.1
@@ -15,9 +17,8 @@ require (
 )
 
 require (
-	github.com/antchfx/xpath v1.3.2 // indirect
+	github.com/antchfx/xpath v1.3.6 // indirect
 	github.com/cucumber/gherkin/go/v26 v26.2.0 // indirect
-	github.com/cucumber/messages/go/v21 v21.0.1 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/gofrs/uuid v4.3.1+incompatible // indirect
 	github.com/golang/groupcache v0.0.0-20210331224755-41bb18bfe9da // indirect
@@ -1,26 +1,50 @@
 package fixture
 
 import (
+	"bufio"
 	"bytes"
+	"cmp"
+	"compress/gzip"
 	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/theboarderline/go-limitless/src/pkg/common"
 	"github.com/theboarderline/go-limitless/src/server/auth"
+	"hash"
 	"io"
+	"maps"
+	"math"
 	"math/rand"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/cookiejar"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode"
 
 	"github.com/antchfx/jsonquery"
+	"github.com/antchfx/xmlquery"
 	"github.com/cucumber/godog"
 	"github.com/cucumber/godog/colors"
+	"github.com/go-faker/faker/v4"
 	"github.com/jinzhu/now"
 	"github.com/joho/godotenv"
 	. "github.com/onsi/gomega"
@@ -30,6 +54,34 @@ import (
 	"github.com/spf13/viper"
 )
 
+var (
+	healthChecks   = make(map[string]error)
+	healthChecksMu sync.Mutex
+)
+
+var (
+	createdResources   []createdResource
+	createdResourcesMu sync.Mutex
+)
+
+type createdResource struct {
+	url    string
+	header http.Header
+}
+
+var randomTokens = map[string]func() string{
+	"${random_email}": func() string { return faker.Email() },
+	"${random_uuid}":  func() string { return faker.UUIDHyphenated() },
+	"${random_name}":  func() string { return faker.Name() },
+	"${random_phone}": func() string { return faker.Phonenumber() },
+}
+
+var envPattern = regexp.MustCompile(`\$\{env\.([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var storePattern = regexp.MustCompile(`\$\{([^${}]+)\}`)
+
+var escapedStorePattern = regexp.MustCompile(`(?:\$|%24)%7[Bb]([^$]+?)%7[Dd]`)
+
 var defaultOpts = godog.Options{
 	Paths:     []string{"features"},
 	Output:    colors.Colored(os.Stdout),
@@ -50,6 +102,22 @@ func NewServerFixture(opts *godog.Options) *ServerFeature {
 
 	viper.SetDefault("lifecycle", "local")
 	viper.SetDefault("http_scheme", "https")
+	viper.SetDefault("api_prefix", "api")
+	viper.SetDefault("rate_limit_max_requests", 1000)
+	viper.SetDefault("rate_limit_max_wait", "60s")
+	viper.SetDefault("timing_samples", 5)
+	viper.SetDefault("request_id_header", "X-Request-ID")
+	viper.SetDefault("auth_headers", []string{"Authorization", "Proxy-Authorization", "Cookie", "X-API-Key"})
+	viper.SetDefault("links_key", "_links")
+	viper.SetDefault("etag_algorithm", "sha256")
+	viper.SetDefault("signed_url_params", []string{"X-Amz-Signature", "X-Amz-Expires"})
+	viper.SetDefault("poll_interval", "1s")
+	viper.SetDefault("stream_timeout", "10s")
+	viper.SetDefault("login_endpoint", "auth/login")
+	viper.SetDefault("max_retries", 0)
+	viper.SetDefault("retry_backoff", "100ms")
+	viper.SetDefault("error_fields", []string{"error"})
+	viper.SetDefault("no_cache_directives", []string{"no-store", "no-cache,private"})
 
 	if err := viper.ReadInConfig(); err != nil {
 		if errors.As(err, &viper.ConfigFileNotFoundError{}) {
@@ -61,6 +129,7 @@ func NewServerFixture(opts *godog.Options) *ServerFeature {
 
 	pflag.BoolP("debug", "v", viper.GetBool("debug"), "debug logs enabled")
 	pflag.StringP("lifecycle", "l", viper.GetString("lifecycle"), "lifecycle to run tests against")
+	pflag.Bool("update", viper.GetBool("update"), "overwrite golden files with the current responses")
 	pflag.Parse()
 	if err := viper.BindPFlags(pflag.CommandLine); err != nil {
 		log.Fatal().Err(err).Msg("failed to bind flags")
@@ -73,37 +142,93 @@ func NewServerFixture(opts *godog.Options) *ServerFeature {
 	}
 
 	return &ServerFeature{
-		replacements: make(map[string]interface{}),
-		store:        make(map[string]interface{}),
+		replacements:   make(map[string]interface{}),
+		store:          make(map[string]interface{}),
+		headers:        make(map[string]string),
+		defaultHeaders: viper.GetStringMapString("default_headers"),
 	}
 }
 
 type ServerFeature struct {
 	replacements map[string]interface{}
 	store        map[string]interface{}
-
-	client *http.Client
-
-	httpResponse *http.Response
-	responseBody string
+	headers      map[string]string
+	contentType  string
+	apiPrefix    *string
+	quiet        bool
+	verbose      bool
+
+	client         *http.Client
+	db             *sql.DB
+	defaultHeaders map[string]string
+	seed           func(ctx context.Context) error
+	cleanup        func(ctx context.Context) error
+
+	httpResponse         *http.Response
+	responseBody         string
+	previousResponseBody string
+	responseDuration     time.Duration
+	streamArrivals       []time.Duration
 
 	response     common.Response
 	authResponse auth.Response
+	username     string
+	password     string
 
+	// user is the account the scenario is logged in as, taken from authResponse.User
+	// on login; authResponse.Token is what authenticates the requests.
 	user auth.User
+
+	lastRequest   sentRequest
+	createdBodies []string
+}
+
+type sentRequest struct {
+	method    string
+	url       string
+	header    http.Header
+	body      string
+	requestID string
 }
 
-func (s *ServerFeature) reset(interface{}) {
+func (s *ServerFeature) reset(sc interface{}) {
+	if s.client != nil {
+		s.client.Jar, _ = cookiejar.New(nil)
+		s.client.CheckRedirect = nil
+	}
+
 	s.replacements = make(map[string]interface{})
 	s.store = make(map[string]interface{})
+	s.headers = make(map[string]string)
+	s.contentType = ""
+
+	s.apiPrefix = nil
+	s.quiet, s.verbose = false, false
+	if scenario, ok := sc.(*godog.Scenario); ok {
+		for _, tag := range scenario.Tags {
+			if prefix, found := strings.CutPrefix(tag.Name, "@prefix:"); found {
+				s.apiPrefix = &prefix
+			}
+			s.quiet = s.quiet || tag.Name == "@quiet"
+			s.verbose = s.verbose || tag.Name == "@verbose"
+		}
+	}
 
 	s.httpResponse = nil
 	s.responseBody = ""
+	s.previousResponseBody = ""
+	s.responseDuration = 0
+	s.streamArrivals = nil
 
 	s.response = common.Response{}
 	s.authResponse = auth.Response{}
+	s.username = ""
+	s.password = ""
 
 	s.user = auth.User{}
+
+	s.lastRequest = sentRequest{}
+	s.createdBodies = nil
 }
 
 func init() {
@@ -119,367 +244,3223 @@ func (s *ServerFeature) Run(m *testing.M) {
 	}
 
 	status := godog.TestSuite{
-		ScenarioInitializer: InitializeScenario,
-		Options:             &defaultOpts,
+		TestSuiteInitializer: InitializeTestSuite,
+		ScenarioInitializer:  s.InitializeScenario,
+		Options:              &defaultOpts,
 	}.Run()
 
 	os.Exit(status)
 }
 
-func (s *ServerFeature) SendRequestWithData(method, endpoint string, body *godog.DocString) error {
-	req, err := http.NewRequest(method, endpoint, s.PrepareBody(body.Content))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+func (s *ServerFeature) SetDB(db *sql.DB) {
+	s.db = db
+}
+
+// SetSeedFunc registers a function run before every scenario; an error aborts the scenario.
+func (s *ServerFeature) SetSeedFunc(seed func(ctx context.Context) error) {
+	s.seed = seed
+}
+
+// SetCleanupFunc registers a function run after every scenario, even a failed one; an error fails the scenario.
+func (s *ServerFeature) SetCleanupFunc(cleanup func(ctx context.Context) error) {
+	s.cleanup = cleanup
+}
+
+func (s *ServerFeature) SendRequestWith(method, endpoint string, body *godog.DocString) error {
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = s.PrepareBody(body.Content)
 	}
 
-	return s.Do(req)
+	return s.sendWithParams(method, endpoint, nil, reqBody)
 }
 
-func (s *ServerFeature) SendRequestWithParams(method, endpoint string, params *godog.DocString) error {
-	req, err := http.NewRequest(method, endpoint, nil)
+// sendWithParams adds params to the query of the endpoint and sends the request.
+func (s *ServerFeature) sendWithParams(method, endpoint string, params map[string]interface{}, body io.Reader) error {
+	req, err := http.NewRequest(method, endpoint, body)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	paramsMap := make(map[string]interface{})
-	if err = json.Unmarshal([]byte(params.Content), &paramsMap); err != nil {
-		return fmt.Errorf("failed to unmarshal params: %v", err)
-	}
-
-	q := req.URL.Query()
-	for k, v := range paramsMap {
-		q.Add(k, fmt.Sprint(v))
+	if len(params) > 0 {
+		q := req.URL.Query()
+		for k, v := range params {
+			q.Add(k, formatJSONValue(v))
+		}
+		req.URL.RawQuery = q.Encode()
 	}
 
-	req.URL.RawQuery = q.Encode()
-
 	return s.Do(req)
 }
 
-func (s *ServerFeature) SendRequest(method, endpoint string) error {
-	req, err := http.NewRequest(method, endpoint, nil)
+func (s *ServerFeature) SendRequestWithData(method, endpoint string, body *godog.DocString) error {
+	return s.SendRequestWith(method, endpoint, body)
+}
+
+func (s *ServerFeature) SendGzippedData(method, endpoint string, body *godog.DocString) error {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write([]byte(s.ReplaceValues(body.Content))); err != nil {
+		return fmt.Errorf("failed to compress body: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to compress body: %v", err)
+	}
+
+	req, err := http.NewRequest(method, endpoint, &compressed)
 	if err != nil {
 		return fmt.Errorf("failed to create request: %v", err)
 	}
+	req.Header.Set("Content-Encoding", "gzip")
+
 	return s.Do(req)
 }
 
-func (s *ServerFeature) TheResponseCodeShouldBe(statusCode int) error {
-	actual := s.httpResponse.StatusCode
-	expected := statusCode
-	if actual != expected {
-		return fmt.Errorf("expected status code %d, got %d: %s", expected, actual, PrettifyJSON(s.responseBody))
+func (s *ServerFeature) SendRequestWithParams(method, endpoint string, params *godog.DocString) error {
+	paramsMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.ReplaceValues(params.Content)), &paramsMap); err != nil {
+		return fmt.Errorf("failed to unmarshal params: %v", err)
 	}
-	return nil
+
+	return s.sendWithParams(method, endpoint, paramsMap, nil)
 }
 
-func (s *ServerFeature) TheResponseShouldNotBeEmpty() error {
-	if s.responseBody == "" {
-		return fmt.Errorf("response is empty")
+func (s *ServerFeature) SendRequestWithParamsAndData(method, endpoint string, content *godog.DocString) error {
+	var payload struct {
+		Params map[string]interface{} `json:"params"`
+		Body   json.RawMessage        `json:"body"`
+	}
+	if err := json.Unmarshal([]byte(s.ReplaceValues(content.Content)), &payload); err != nil {
+		return fmt.Errorf("failed to unmarshal params and body: %v", err)
 	}
 
-	return nil
+	return s.sendWithParams(method, endpoint, payload.Params, bytes.NewReader(payload.Body))
 }
 
-func (s *ServerFeature) TheResponseShouldContain(body *godog.DocString) error {
-	actual := common.CleanString(fmt.Sprint(s.responseBody))
-	expected := common.CleanString(body.Content)
-	if actual == "" {
-		return fmt.Errorf("response is empty")
-	} else if !strings.Contains(actual, expected) {
-		return fmt.Errorf("response does not contain %s, got %s", expected, PrettifyJSON(actual))
-	}
+func (s *ServerFeature) SendRequestWithForm(method, endpoint string, body *godog.DocString) error {
+	form := url.Values{}
 
-	return nil
-}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(body.Content), &fields); err == nil {
+		for k, v := range fields {
+			form.Add(k, s.ReplaceValues(formatJSONValue(v)))
+		}
+	} else {
+		for _, line := range strings.Split(body.Content, "\n") {
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
 
-func (s *ServerFeature) TheResponseShouldContainA(key string) error {
-	key = s.ReplaceValues(key)
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return fmt.Errorf("form line %q is not a key=value pair", line)
+			}
+			form.Add(strings.TrimSpace(k), s.ReplaceValues(strings.TrimSpace(v)))
+		}
+	}
 
-	res, err := json.Marshal(s.responseBody)
+	req, err := http.NewRequest(method, endpoint, strings.NewReader(form.Encode()))
 	if err != nil {
-		return fmt.Errorf("failed to marshal response: %v", err)
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	actual := common.CleanString(string(res))
-	if !strings.Contains(actual, key) {
-		return fmt.Errorf("response does not contain %s, got %s", key, PrettifyJSON(actual))
-	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-	return nil
+	return s.Do(req)
 }
 
-func (s *ServerFeature) TheResponseShouldContainAWithItems(key string, body *godog.DocString) error {
-	key = s.ReplaceValues(key)
+func (s *ServerFeature) SendBodyFromFile(method, endpoint, localPath string) error {
+	localPath = s.ReplaceValues(localPath)
 
-	val, err := s.GetNodeFromResponse(key)
-	if err != nil {
-		return err
+	content, err := os.ReadFile(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file %s does not exist", localPath)
+	} else if err != nil {
+		return fmt.Errorf("failed to read file %s: %v", localPath, err)
 	}
 
-	actual := val.Value()
-	if actual == nil || actual == "<nil>" {
-		return fmt.Errorf("item not found in response: %s", PrettifyJSON(s.responseBody))
+	contentType := mime.TypeByExtension(filepath.Ext(localPath))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
 	}
 
-	var expectedItems []interface{}
-	if err = json.Unmarshal([]byte(body.Content), &expectedItems); err != nil {
-		return fmt.Errorf("expected items is not a list: %v", err)
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(content))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	for _, expectedItem := range expectedItems {
-		if actualList, ok := actual.([]interface{}); ok {
-			found := false
-			for _, actualItem := range actualList {
-				if reflect.DeepEqual(actualItem, expectedItem) {
-					found = true
-					break
-				}
-			}
-			if !found {
-				return fmt.Errorf("response item does not contain %v, got %v", expectedItem, actual)
-			}
-		} else {
-			return fmt.Errorf("response item is not a list")
-		}
-	}
+	req.Header.Set("Content-Type", contentType)
 
-	return nil
+	return s.Do(req)
 }
 
-func (s *ServerFeature) TheResponseShouldContainSetTo(property, value string) error {
-	value = s.ReplaceValues(value)
+func (s *ServerFeature) UploadFile(localPath, fieldName, endpoint string) error {
+	return s.uploadFile(localPath, fieldName, endpoint, nil)
+}
 
-	val, err := s.GetNodeFromResponse(property)
-	if err != nil {
-		return err
+func (s *ServerFeature) UploadFileWithFields(localPath, fieldName, endpoint string, fields *godog.DocString) error {
+	fieldsMap := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.ReplaceValues(fields.Content)), &fieldsMap); err != nil {
+		return fmt.Errorf("failed to unmarshal form fields: %v", err)
 	}
 
-	if fmt.Sprint(val.Value()) != value {
-		return fmt.Errorf("the json query path %s does not contain %s: %s", property, value, PrettifyJSON(s.responseBody))
+	return s.uploadFile(localPath, fieldName, endpoint, fieldsMap)
+}
+
+func (s *ServerFeature) uploadFile(localPath, fieldName, endpoint string, fields map[string]interface{}) error {
+	localPath = s.ReplaceValues(localPath)
+
+	file, err := os.Open(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("file %s does not exist", localPath)
+	} else if err != nil {
+		return fmt.Errorf("failed to open file %s: %v", localPath, err)
 	}
+	defer file.Close()
 
-	return nil
-}
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
 
-func (s *ServerFeature) TheResponseShouldContainATimeSetTo(jsonQueryPath, value string) error {
-	val, err := s.GetNodeFromResponse(jsonQueryPath)
-	if err != nil {
-		return err
+	for k, v := range fields {
+		if err = writer.WriteField(k, fmt.Sprint(v)); err != nil {
+			return fmt.Errorf("failed to write form field %s: %v", k, err)
+		}
 	}
 
-	actualValue := fmt.Sprint(val.Value())
-	actualTime, err := now.Parse(actualValue)
+	part, err := writer.CreateFormFile(fieldName, filepath.Base(localPath))
 	if err != nil {
-		return fmt.Errorf("failed to parse actual time: %v", err)
+		return fmt.Errorf("failed to create form file: %v", err)
 	}
-	expectedTime, err := now.Parse(value)
-	if err != nil {
-		return fmt.Errorf("failed to parse expected time: %v", err)
+
+	if _, err = io.Copy(part, file); err != nil {
+		return fmt.Errorf("failed to read file %s: %v", localPath, err)
 	}
 
-	if actualTime != expectedTime {
-		return fmt.Errorf("the json query path %s does not contain %s: %s", jsonQueryPath, value, PrettifyJSON(s.responseBody))
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize multipart body: %v", err)
 	}
 
-	return nil
+	req, err := http.NewRequest(http.MethodPost, endpoint, &body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return s.Do(req)
 }
 
-func (s *ServerFeature) TheResponseShouldContainAThatIsNull(jsonQueryPath string) error {
-	val, err := s.GetNodeFromResponse(jsonQueryPath)
+func (s *ServerFeature) SendEmptyBody(method, endpoint string) error {
+	req, err := http.NewRequest(method, endpoint, http.NoBody)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	dataFound := false
+	return s.Do(req)
+}
 
-	for _, child := range val.ChildNodes() {
-		if child.Value() != nil && child.Value() != "<nil>" {
-			dataFound = true
-			break
+func (s *ServerFeature) SendArrayOfSize(method, endpoint, arrayField string, n int) error {
+	return s.SendArrayOfSizeFromTemplate(method, endpoint, arrayField, n, &godog.DocString{Content: `{"index": ${index}}`})
+}
+
+func (s *ServerFeature) SendArrayOfSizeFromTemplate(method, endpoint, arrayField string, n int, template *godog.DocString) error {
+	items := make([]json.RawMessage, n)
+	for i := range items {
+		item := s.ReplaceValues(strings.ReplaceAll(template.Content, "${index}", strconv.Itoa(i)))
+		if !json.Valid([]byte(item)) {
+			return fmt.Errorf("item template does not produce valid json: %s", item)
 		}
+		items[i] = json.RawMessage(item)
 	}
 
-	if dataFound {
-		return fmt.Errorf("the json query path %s does not contain a null value: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	body, err := json.Marshal(map[string]interface{}{arrayField: items})
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %v", err)
 	}
 
-	return nil
+	return s.SendRequestWith(method, endpoint, &godog.DocString{Content: string(body)})
 }
 
-func (s *ServerFeature) TheResponseShouldContainAThatIsNotNull(jsonQueryPath string) error {
-	val, err := s.GetNodeFromResponse(jsonQueryPath)
+func (s *ServerFeature) SendGraphQLQuery(endpoint string, query *godog.DocString) error {
+	content := s.ReplaceValues(query.Content)
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &payload); err != nil || payload["query"] == nil {
+		payload = map[string]interface{}{"query": content}
+	}
+
+	body, err := json.Marshal(payload)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to marshal graphql payload: %v", err)
 	}
 
-	dataFound := false
+	return s.SendRequestWith(http.MethodPost, endpoint, &godog.DocString{Content: string(body)})
+}
 
-	for _, child := range val.ChildNodes() {
-		if child.Value() != nil && child.Value() != "<nil>" {
-			dataFound = true
-			break
-		}
+func (s *ServerFeature) TheGraphQLResponseShouldNotHaveErrors() error {
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
 	}
 
-	if !dataFound {
-		return fmt.Errorf("the json query path %s contains a null value", jsonQueryPath)
+	if len(body.Errors) > 0 {
+		messages := make([]string, len(body.Errors))
+		for i, e := range body.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("graphql response has errors: %s", strings.Join(messages, "; "))
 	}
 
 	return nil
 }
 
-func (s *ServerFeature) TheResponseShouldContainAThatIsEmpty(jsonQueryPath string) error {
-	val, err := s.GetNodeFromResponse(jsonQueryPath)
-	if err != nil {
-		return err
+func (s *ServerFeature) ResendLastRequest() error {
+	if s.lastRequest.method == "" {
+		return fmt.Errorf("no request has been sent yet")
 	}
 
-	if len(val.ChildNodes()) > 0 {
-		return fmt.Errorf("the json query path %s contains items: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	var body io.Reader
+	if s.lastRequest.body != "" {
+		body = strings.NewReader(s.lastRequest.body)
 	}
 
-	return nil
-}
-
-func (s *ServerFeature) TheResponseShouldContainAThatIsNotEmpty(jsonQueryPath string) error {
-	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	req, err := http.NewRequest(s.lastRequest.method, s.lastRequest.url, body)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to create request: %v", err)
 	}
+	req.Header = s.lastRequest.header.Clone()
 
-	if len(val.ChildNodes()) == 0 {
-		return fmt.Errorf("the json query path %s does not contain any items: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	return s.Do(req)
+}
+
+// SendStreamingRequest reads the body for at most the given number of seconds,
+// or stream_timeout, recording whatever arrived once the deadline passes.
+func (s *ServerFeature) SendStreamingRequest(method, endpoint, seconds string) error {
+	timeout := viper.GetDuration("stream_timeout")
+	if seconds != "" {
+		n, err := strconv.Atoi(seconds)
+		if err != nil {
+			return fmt.Errorf("invalid stream duration %q: %v", seconds, err)
+		}
+		timeout = time.Duration(n) * time.Second
 	}
 
-	return nil
-}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-func (s *ServerFeature) TheResponseHaveLength(length int) error {
-	items := make([]interface{}, 0)
-	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
-		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
 	}
 
-	if len(items) != length {
-		return fmt.Errorf("the response contains %d items, expected %d: %s", len(items), length, PrettifyJSON(s.responseBody))
+	s.prepareRequest(req)
+
+	start := time.Now()
+	response, err := s.client.Do(req)
+	s.client.CheckRedirect = nil
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
 	}
+	defer response.Body.Close()
 
-	return nil
-}
+	s.streamArrivals = nil
 
-func (s *ServerFeature) TheResponseShouldContainAWithLength(jsonQueryPath string, length int) error {
-	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	reader, err := responseBodyReader(response)
 	if err != nil {
-		return err
+		if ctx.Err() == nil {
+			return fmt.Errorf("failed to decompress response body: %v", err)
+		}
+		reader = http.NoBody
 	}
 
-	if len(val.ChildNodes()) != length {
-		return fmt.Errorf("the json query path %s does not contain %d items: %s", jsonQueryPath, length, PrettifyJSON(s.responseBody))
+	var body bytes.Buffer
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := reader.Read(buf)
+		if n > 0 {
+			elapsed := time.Since(start)
+			for range bytes.Count(buf[:n], []byte("\n")) {
+				s.streamArrivals = append(s.streamArrivals, elapsed)
+			}
+			body.Write(buf[:n])
+		}
+
+		if readErr == io.EOF || ctx.Err() != nil {
+			if ctx.Err() != nil {
+				log.Debug().Msgf("stopped reading stream after %s", timeout)
+			}
+			if body.Len() > 0 && !bytes.HasSuffix(body.Bytes(), []byte("\n")) {
+				s.streamArrivals = append(s.streamArrivals, time.Since(start))
+			}
+			break
+		} else if readErr != nil {
+			return fmt.Errorf("failed to read response body: %v", readErr)
+		}
 	}
 
+	s.responseDuration = time.Since(start)
+	s.recordResponse(req, response, body.Bytes())
 	return nil
 }
 
-func (s *ServerFeature) TheResponseContainsItemWithPropertySetTo(property, value string) error {
-	value = s.ReplaceValues(value)
+func (s *ServerFeature) SendRequest(method, endpoint string) error {
+	return s.SendRequestWith(method, endpoint, nil)
+}
 
-	items := make([]interface{}, 0)
-	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
-		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+func (s *ServerFeature) SendRequestIfResponseCodeWas(statusCode int, method, endpoint string) error {
+	if s.httpResponse == nil {
+		return fmt.Errorf("no response has been received yet")
 	}
 
-	for _, item := range items {
-		itemMap := item.(map[string]interface{})
-		itemValue := fmt.Sprint(itemMap[property])
-		if itemValue == value {
-			return nil
-		}
+	if s.httpResponse.StatusCode != statusCode {
+		return nil
 	}
 
-	return fmt.Errorf("no item found with %s set to %s", property, value)
+	return s.SendRequest(method, endpoint)
 }
 
-func (s *ServerFeature) TheResponseContainsItemAtIndexWithPropertySetTo(index int, property, value string) error {
+func (s *ServerFeature) FollowRedirects() error {
+	s.client.CheckRedirect = nil
+	return nil
+}
+
+// DoNotFollowRedirects returns 3xx responses as they are for the next request only.
+func (s *ServerFeature) DoNotFollowRedirects() error {
+	s.client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+func (s *ServerFeature) SetHeader(name, value string) error {
+	s.headers[s.ReplaceValues(name)] = s.ReplaceValues(value)
+	return nil
+}
+
+func (s *ServerFeature) SetHeaders(table *godog.Table) error {
+	for _, row := range tableRows(table, "name") {
+		if len(row) < 2 {
+			return fmt.Errorf("each header needs a name and a value, got %v", row)
+		}
+
+		s.headers[s.ReplaceValues(row[0])] = s.ReplaceValues(row[1])
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) SetContentType(contentType string) error {
+	s.contentType = s.ReplaceValues(contentType)
+	return nil
+}
+
+func (s *ServerFeature) ClearHeaders() error {
+	s.headers = make(map[string]string)
+	return nil
+}
+
+func (s *ServerFeature) AuthenticateWithBasicAuth(username, password string) error {
+	s.username = s.ReplaceValues(username)
+	s.password = s.ReplaceValues(password)
+	return nil
+}
+
+func (s *ServerFeature) LogInAs(username string) error {
+	username = s.ReplaceValues(username)
+
+	body, err := json.Marshal(map[string]string{
+		"username": username,
+		"password": s.ReplaceValues(viper.GetString("users." + username)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal login body: %v", err)
+	}
+
+	s.authResponse = auth.Response{}
+	if err = s.SendRequestWith(http.MethodPost, viper.GetString("login_endpoint"), &godog.DocString{Content: string(body)}); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("failed to log in as %s, got %d: %s", username, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	if err = json.Unmarshal([]byte(s.responseBody), &s.authResponse); err != nil || s.authResponse.Token == "" {
+		return fmt.Errorf("login response for %s has no token: %s", username, PrettifyJSON(s.responseBody))
+	}
+
+	s.user = s.authResponse.User
+	return nil
+}
+
+// redactPasswords hides the passwords of the configured users, as written
+// raw or JSON-escaped, in request bodies that are logged or attached.
+func (s *ServerFeature) redactPasswords(body string) string {
+	for _, password := range viper.GetStringMapString("users") {
+		if password = s.ReplaceValues(password); password == "" {
+			continue
+		}
+		body = strings.ReplaceAll(body, password, "[redacted]")
+		if escaped, err := json.Marshal(password); err == nil {
+			body = strings.ReplaceAll(body, strings.Trim(string(escaped), `"`), "[redacted]")
+		}
+	}
+	return body
+}
+
+func (s *ServerFeature) TheCurrentUserIDShouldBe(id string) error {
+	id = s.ReplaceValues(id)
+
+	if s.user.ID != id {
+		return fmt.Errorf("expected current user id %q, got %q", id, s.user.ID)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) ObtainClientCredentialsToken(tokenURL, clientID, clientSecret string) error {
+	tokenURL = s.FormatURL(s.ReplaceValues(tokenURL)).String()
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create token request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(s.ReplaceValues(clientID)), url.QueryEscape(s.ReplaceValues(clientSecret)))
+
+	response, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to request token from %s: %v", tokenURL, err)
+	}
+	defer response.Body.Close()
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	body, _ := io.ReadAll(response.Body)
+	if err = json.Unmarshal(body, &token); err != nil {
+		return fmt.Errorf("token endpoint %s returned %d with an invalid body: %s", tokenURL, response.StatusCode, body)
+	}
+
+	if response.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return fmt.Errorf("token endpoint %s returned %d: %s %s", tokenURL, response.StatusCode, token.Error, token.ErrorDescription)
+	}
+
+	s.authResponse.Token = token.AccessToken
+	return nil
+}
+
+func (s *ServerFeature) RetryRequestUntil(method, endpoint string, statusCode, seconds int) error {
+	endpoint = s.ReplaceValues(endpoint)
+	deadline := time.Now().Add(time.Duration(seconds) * time.Second)
+	interval := viper.GetDuration("poll_interval")
+
+	for {
+		if err := s.SendRequest(method, endpoint); err != nil {
+			return err
+		}
+
+		if s.httpResponse.StatusCode == statusCode {
+			return nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("expected status code %d within %ds, last got %d: %s", statusCode, seconds, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+func (s *ServerFeature) Wait(ctx context.Context, ms int) error {
+	timer := time.NewTimer(time.Duration(ms) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *ServerFeature) TheResponseCodeShouldBe(statusCode int) error {
+	actual := s.httpResponse.StatusCode
+	expected := statusCode
+	if actual != expected {
+		return fmt.Errorf("expected status code %d, got %d: %s", expected, actual, PrettifyJSON(s.responseBody))
+	}
+	return nil
+}
+
+func (s *ServerFeature) TheResponseTimeShouldBeLessThan(ms int) error {
+	if limit := time.Duration(ms) * time.Millisecond; s.responseDuration >= limit {
+		return fmt.Errorf("expected response time under %s, took %s", limit, s.responseDuration)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldNotBeEmpty() error {
+	if s.responseBody == "" {
+		return fmt.Errorf("response is empty")
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContain(body *godog.DocString) error {
+	actual := common.CleanString(fmt.Sprint(s.responseBody))
+	expected := common.CleanString(body.Content)
+	if actual == "" {
+		return fmt.Errorf("response is empty")
+	} else if !strings.Contains(actual, expected) {
+		return fmt.Errorf("response does not contain %s, got %s", expected, PrettifyJSON(actual))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainA(key string) error {
+	key = s.ReplaceValues(key)
+
+	res, err := json.Marshal(s.responseBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %v", err)
+	}
+
+	actual := common.CleanString(string(res))
+	if !strings.Contains(actual, key) {
+		return fmt.Errorf("response does not contain %s, got %s", key, PrettifyJSON(actual))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldEqualUnordered(jsonQueryPath string, body *godog.DocString) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	actualItems, ok := val.Value().([]interface{})
+	if !ok {
+		return fmt.Errorf("the json query path %s is not an array: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	var expectedItems []interface{}
+	if err = json.Unmarshal([]byte(s.ReplaceValues(body.Content)), &expectedItems); err != nil {
+		return fmt.Errorf("expected items is not a list: %v", err)
+	}
+
+	extra := slices.Clone(actualItems)
+	var missing []interface{}
+	for _, expectedItem := range expectedItems {
+		i := slices.IndexFunc(extra, func(actualItem interface{}) bool {
+			return reflect.DeepEqual(actualItem, expectedItem)
+		})
+		if i == -1 {
+			missing = append(missing, expectedItem)
+			continue
+		}
+		extra = slices.Delete(extra, i, i+1)
+	}
+
+	if len(missing) > 0 || len(extra) > 0 {
+		missingJSON, _ := json.Marshal(missing)
+		extraJSON, _ := json.Marshal(extra)
+		return fmt.Errorf("the json query path %s is missing items %s and has extra items %s", jsonQueryPath, missingJSON, extraJSON)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainAWithItems(key string, body *godog.DocString) error {
+	key = s.ReplaceValues(key)
+
+	val, err := s.GetNodeFromResponse(key)
+	if err != nil {
+		return err
+	}
+
+	actual := val.Value()
+	if actual == nil || actual == "<nil>" {
+		return fmt.Errorf("item not found in response: %s", PrettifyJSON(s.responseBody))
+	}
+
+	var expectedItems []interface{}
+	if err = json.Unmarshal([]byte(body.Content), &expectedItems); err != nil {
+		return fmt.Errorf("expected items is not a list: %v", err)
+	}
+
+	for _, expectedItem := range expectedItems {
+		if actualList, ok := actual.([]interface{}); ok {
+			found := false
+			for _, actualItem := range actualList {
+				if reflect.DeepEqual(actualItem, expectedItem) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("response item does not contain %v, got %v", expectedItem, actual)
+			}
+		} else {
+			return fmt.Errorf("response item is not a list")
+		}
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainSetTo(property, value string) error {
 	value = s.ReplaceValues(value)
 
-	items := make([]interface{}, 0)
-	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
-		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	val, err := s.GetNodeFromResponse(property)
+	if err != nil {
+		return err
+	}
+
+	if fmt.Sprint(val.Value()) != value {
+		return fmt.Errorf("the json query path %s does not contain %s: %s", property, value, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainATimeSetTo(jsonQueryPath, value string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	actualValue := fmt.Sprint(val.Value())
+	actualTime, err := now.Parse(actualValue)
+	if err != nil {
+		return fmt.Errorf("failed to parse actual time: %v", err)
+	}
+	expectedTime, err := now.Parse(value)
+	if err != nil {
+		return fmt.Errorf("failed to parse expected time: %v", err)
+	}
+
+	if actualTime != expectedTime {
+		return fmt.Errorf("the json query path %s does not contain %s: %s", jsonQueryPath, value, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeWithinSecondsOfNow(jsonQueryPath string, seconds int) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	actualTime, err := now.Parse(fmt.Sprint(val.Value()))
+	if err != nil {
+		return fmt.Errorf("failed to parse actual time: %v", err)
+	}
+
+	if offset := time.Since(actualTime); offset.Abs() > time.Duration(seconds)*time.Second {
+		return fmt.Errorf("the json query path %s is %s, which is %s from now, expected within %ds", jsonQueryPath, val.Value(), offset.Round(time.Second), seconds)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainAThatIsNull(jsonQueryPath string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	dataFound := false
+
+	for _, child := range val.ChildNodes() {
+		if child.Value() != nil && child.Value() != "<nil>" {
+			dataFound = true
+			break
+		}
+	}
+
+	if dataFound {
+		return fmt.Errorf("the json query path %s does not contain a null value: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainAThatIsNotNull(jsonQueryPath string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	dataFound := false
+
+	for _, child := range val.ChildNodes() {
+		if child.Value() != nil && child.Value() != "<nil>" {
+			dataFound = true
+			break
+		}
+	}
+
+	if !dataFound {
+		return fmt.Errorf("the json query path %s contains a null value", jsonQueryPath)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainAThatIsEmpty(jsonQueryPath string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if len(val.ChildNodes()) > 0 {
+		return fmt.Errorf("the json query path %s contains items: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainAThatIsNotEmpty(jsonQueryPath string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if len(val.ChildNodes()) == 0 {
+		return fmt.Errorf("the json query path %s does not contain any items: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseHaveLength(length int) error {
+	items := make([]interface{}, 0)
+	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
+		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	}
+
+	if len(items) != length {
+		return fmt.Errorf("the response contains %d items, expected %d: %s", len(items), length, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheHeaderShouldEqualTheResponseLength(header string) error {
+	value := s.httpResponse.Header.Get(header)
+	total, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("header %s is not an integer: %q", header, value)
+	}
+
+	items := make([]interface{}, 0)
+	if err = json.Unmarshal([]byte(s.responseBody), &items); err != nil {
+		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	}
+
+	if len(items) != total {
+		return fmt.Errorf("header %s is %d but the response contains %d items", header, total, len(items))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldContainAWithLength(jsonQueryPath string, length int) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if len(val.ChildNodes()) != length {
+		return fmt.Errorf("the json query path %s does not contain %d items: %s", jsonQueryPath, length, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseContainsItemWithPropertySetTo(property, value string) error {
+	value = s.ReplaceValues(value)
+
+	items := make([]interface{}, 0)
+	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
+		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	}
+
+	for _, item := range items {
+		itemMap := item.(map[string]interface{})
+		itemValue := fmt.Sprint(itemMap[property])
+		if itemValue == value {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no item found with %s set to %s", property, value)
+}
+
+func (s *ServerFeature) TheResponseShouldContainNItemsWhere(count int, jsonQueryPath, property, value string) error {
+	value = s.ReplaceValues(value)
+
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	items, ok := val.Value().([]interface{})
+	if !ok {
+		return fmt.Errorf("the json query path %s is not an array: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	matched := 0
+	for _, item := range items {
+		if actual, ok := lookupPath(item, property); ok && fmt.Sprint(actual) == value {
+			matched++
+		}
+	}
+
+	if matched != count {
+		return fmt.Errorf("found %d items in %s with %s set to %s, expected %d", matched, jsonQueryPath, property, value, count)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseContainsItemAtIndexWithPropertySetTo(index int, property, value string) error {
+	value = s.ReplaceValues(value)
+
+	items := make([]interface{}, 0)
+	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
+		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	}
+
+	if index >= len(items) {
+		return fmt.Errorf("not enough items in response to get item at index %d, found %d", index, len(items))
+	}
+
+	itemMap := items[index].(map[string]interface{})
+	itemValue := fmt.Sprint(itemMap[property])
+	if itemValue != value {
+		return fmt.Errorf("item at index %d does not have %s set to %s, found %s", index, property, value, itemValue)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) SaveValueFromResponse(key string) error {
+	val, err := s.GetNodeFromResponse(key)
+	if err != nil {
+		return err
+	}
+
+	s.store[key] = val.Value()
+	return nil
+}
+
+func (s *ServerFeature) SaveResponseAs(key string) error {
+	var body interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	s.store[key] = body
+	return nil
+}
+
+func (s *ServerFeature) SaveValueFromResponseList(index int, key, value string) error {
+	val, err := s.GetNodeFromResponse(key)
+	if err != nil {
+		return err
+	}
+
+	if index >= len(val.ChildNodes()) {
+		return fmt.Errorf("not enough items in response to get item at index %d, found %d", index, len(val.ChildNodes()))
+	}
+
+	s.store[value] = val.ChildNodes()[index].Value()
+	return nil
+}
+
+func (s *ServerFeature) SaveHeaderFromResponse(header, key string) error {
+	values := s.httpResponse.Header.Values(header)
+	if len(values) == 0 {
+		return fmt.Errorf("response does not have header %s", header)
+	}
+
+	s.store[key] = values[0]
+	return nil
+}
+
+func (s *ServerFeature) RegisterCreatedResourceForCleanup() error {
+	if s.httpResponse == nil || s.httpResponse.StatusCode < http.StatusOK || s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("the last response is not a successful creation")
+	}
+
+	requestURL := s.httpResponse.Request.URL
+
+	var resourceURL *url.URL
+	if location := s.httpResponse.Header.Get("Location"); location != "" {
+		parsed, err := requestURL.Parse(location)
+		if err != nil {
+			return fmt.Errorf("invalid Location header %q: %v", location, err)
+		}
+		resourceURL = parsed
+	} else {
+		body := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+			return fmt.Errorf("failed to unmarshal response into object: %v", err)
+		}
+
+		id, ok := body["id"]
+		if !ok {
+			return fmt.Errorf("response has neither a Location header nor an id: %s", PrettifyJSON(s.responseBody))
+		}
+		resourceURL = requestURL.JoinPath(url.PathEscape(formatJSONValue(id)))
+		resourceURL.RawQuery = ""
+	}
+
+	header := http.Header{}
+	for name, values := range s.lastRequest.header {
+		if isAuthHeader(name) {
+			header[name] = slices.Clone(values)
+		}
+	}
+	if s.client.Jar != nil {
+		cleanupRequest := &http.Request{Header: header}
+		for _, cookie := range s.client.Jar.Cookies(resourceURL) {
+			cleanupRequest.AddCookie(cookie)
+		}
+	}
+
+	createdResourcesMu.Lock()
+	createdResources = append(createdResources, createdResource{url: resourceURL.String(), header: header})
+	createdResourcesMu.Unlock()
+
+	return nil
+}
+
+// formatJSONValue formats a decoded JSON value, writing numbers out in full
+// rather than in the exponent form fmt uses for large float64 values.
+func formatJSONValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func (s *ServerFeature) WriteResponseToFile(path string) error {
+	path = s.ReplaceValues(path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", path, err)
+	}
+
+	if err := os.WriteFile(path, []byte(PrettifyJSON(s.responseBody)), 0o644); err != nil {
+		return fmt.Errorf("failed to write response to %s: %v", path, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) GetNodeFromResponse(queryPath string) (*jsonquery.Node, error) {
+	doc, err := jsonquery.Parse(strings.NewReader(s.responseBody))
+	if err != nil {
+		return nil, err
+	}
+
+	queryPath = strings.ReplaceAll(queryPath, ".", "/")
+
+	extractedValue := jsonquery.FindOne(doc, fmt.Sprintf("//%s", queryPath))
+	if extractedValue == nil {
+		return nil, fmt.Errorf("'%s' not found in response: %s", queryPath, PrettifyJSON(s.responseBody))
+	}
+
+	return extractedValue, nil
+}
+
+func (s *ServerFeature) SendXMLRequest(method, endpoint string, body *godog.DocString) error {
+	return s.SendWithContentType(method, endpoint, "text/xml", body)
+}
+
+func (s *ServerFeature) GetXMLNodeFromResponse(xpath string) (*xmlquery.Node, error) {
+	doc, err := xmlquery.Parse(strings.NewReader(s.responseBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse xml response: %v", err)
+	}
+
+	node, err := xmlquery.Query(doc, xpath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid xpath %s: %v", xpath, err)
+	}
+
+	if node == nil {
+		return nil, fmt.Errorf("'%s' not found in response: %s", xpath, s.responseBody)
+	}
+
+	return node, nil
+}
+
+func (s *ServerFeature) TheResponseXMLShouldBe(xpath, value string) error {
+	node, err := s.GetXMLNodeFromResponse(xpath)
+	if err != nil {
+		return err
+	}
+
+	value = s.ReplaceValues(value)
+	if actual := strings.TrimSpace(node.InnerText()); actual != value {
+		return fmt.Errorf("the xpath %s is %q, expected %q: %s", xpath, actual, value, s.responseBody)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldNotContainA(key string) error {
+	res, err := json.Marshal(s.responseBody)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %v", err)
+	}
+
+	actual := common.CleanString(string(res))
+	if strings.Contains(actual, key) {
+		return fmt.Errorf("response contains %s, got %s", key, actual)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldNotContainPath(jsonQueryPath string) error {
+	if !json.Valid([]byte(s.responseBody)) {
+		return fmt.Errorf("response is not valid json: %s", s.responseBody)
+	}
+
+	if val, err := s.GetNodeFromResponse(jsonQueryPath); err == nil {
+		return fmt.Errorf("response contains %s set to %v: %s", jsonQueryPath, val.Value(), PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldMatchJSON(body *godog.DocString) error {
+	if s.responseBody == "" {
+		return fmt.Errorf("response is empty")
+	} else if !strings.Contains(s.responseBody, body.Content) {
+		return fmt.Errorf("response does not match %s, got %s", body.Content, s.responseBody)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) SendRangeRequest(endpoint, rangeSpec string) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Range", s.ReplaceValues(rangeSpec))
+
+	return s.Do(req)
+}
+
+func (s *ServerFeature) TheResponseShouldBePartialContent() error {
+	if err := s.TheResponseCodeShouldBe(http.StatusPartialContent); err != nil {
+		return err
+	}
+
+	contentRange := s.httpResponse.Header.Get("Content-Range")
+	if contentRange == "" {
+		return fmt.Errorf("response is missing a Content-Range header")
+	}
+
+	var start, end int64
+	var size string
+	if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &size); err != nil {
+		return fmt.Errorf("invalid Content-Range header %q: %v", contentRange, err)
+	}
+
+	if end < start {
+		return fmt.Errorf("invalid Content-Range header %q: end is before start", contentRange)
+	}
+
+	if size != "*" {
+		total, err := strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid Content-Range header %q: %v", contentRange, err)
+		}
+		if end >= total {
+			return fmt.Errorf("invalid Content-Range header %q: end is beyond the complete length", contentRange)
+		}
+	}
+
+	expected := end - start + 1
+	if actual := int64(len(s.responseBody)); actual != expected {
+		return fmt.Errorf("expected partial body of %d bytes for range %q, got %d", expected, contentRange, actual)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheRateLimitShouldResetAndAllowRequests(method, endpoint string) error {
+	maxRequests := viper.GetInt("rate_limit_max_requests")
+
+	limited := false
+	for i := 0; i < maxRequests; i++ {
+		if err := s.SendRequest(method, endpoint); err != nil {
+			return err
+		}
+		if s.httpResponse.StatusCode == http.StatusTooManyRequests {
+			limited = true
+			break
+		}
+	}
+
+	if !limited {
+		return fmt.Errorf("rate limit was not reached after %d requests", maxRequests)
+	}
+
+	wait, err := rateLimitResetWait(s.httpResponse.Header.Get("X-RateLimit-Reset"))
+	if err != nil {
+		return err
+	}
+
+	maxWait := viper.GetDuration("rate_limit_max_wait")
+	if wait > maxWait {
+		return fmt.Errorf("rate limit resets in %s, which exceeds the maximum wait of %s", wait, maxWait)
+	}
+
+	log.Debug().Msgf("rate limited, waiting %s for reset", wait)
+	time.Sleep(wait)
+
+	if err = s.SendRequest(method, endpoint); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("request was still rate limited after waiting %s: %s", wait, PrettifyJSON(s.responseBody))
+	} else if s.httpResponse.StatusCode < http.StatusOK || s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("expected a successful response after the rate limit reset, got %d: %s", s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func rateLimitResetWait(header string) (time.Duration, error) {
+	if header == "" {
+		return 0, fmt.Errorf("rate limited response is missing an X-RateLimit-Reset header")
+	}
+
+	reset, err := strconv.ParseInt(header, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid X-RateLimit-Reset header %q: %v", header, err)
+	}
+
+	// servers send either the seconds remaining or the unix time of the reset
+	wait := time.Duration(reset) * time.Second
+	if reset > 1_000_000_000 {
+		wait = time.Until(time.Unix(reset, 0))
+	}
+
+	return max(wait, 0), nil
+}
+
+func (s *ServerFeature) ProtectedRoutesRequireAuth(table *godog.Table) error {
+	token, username, password := s.authResponse.Token, s.username, s.password
+	client, headers, defaultHeaders := s.client, s.headers, s.defaultHeaders
+	s.authResponse.Token, s.username, s.password = "", "", ""
+	s.client = &http.Client{Transport: client.Transport, CheckRedirect: client.CheckRedirect, Timeout: client.Timeout}
+	s.headers, s.defaultHeaders = withoutAuthHeaders(headers), withoutAuthHeaders(defaultHeaders)
+	defer func() {
+		s.authResponse.Token, s.username, s.password = token, username, password
+		s.client, s.headers, s.defaultHeaders = client, headers, defaultHeaders
+	}()
+
+	var unprotected []string
+	for _, row := range tableRows(table, "method") {
+		if len(row) < 2 {
+			return fmt.Errorf("each route needs a method and an endpoint, got %v", row)
+		}
+
+		method, endpoint := row[0], s.ReplaceValues(row[1])
+		if err := s.SendRequest(method, endpoint); err != nil {
+			return err
+		}
+
+		code := s.httpResponse.StatusCode
+		if code != http.StatusUnauthorized && code != http.StatusForbidden {
+			unprotected = append(unprotected, fmt.Sprintf("%s %s returned %d", method, endpoint, code))
+		}
+	}
+
+	if len(unprotected) > 0 {
+		return fmt.Errorf("routes allowed anonymous access:\n%s", strings.Join(unprotected, "\n"))
+	}
+
+	return nil
+}
+
+func isAuthHeader(name string) bool {
+	return slices.ContainsFunc(viper.GetStringSlice("auth_headers"), func(authHeader string) bool {
+		return strings.EqualFold(authHeader, name)
+	})
+}
+
+func withoutAuthHeaders(headers map[string]string) map[string]string {
+	filtered := make(map[string]string, len(headers))
+	for name, value := range headers {
+		if !isAuthHeader(name) {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+func tableRows(table *godog.Table, header string) [][]string {
+	rows := make([][]string, 0, len(table.Rows))
+	for i, row := range table.Rows {
+		cells := make([]string, len(row.Cells))
+		for j, cell := range row.Cells {
+			cells[j] = strings.TrimSpace(cell.Value)
+		}
+
+		if i == 0 && len(cells) > 0 && strings.EqualFold(cells[0], header) {
+			continue
+		}
+
+		rows = append(rows, cells)
+	}
+
+	return rows
+}
+
+func (s *ServerFeature) TheResponseDepthShouldBeAtMost(n int) error {
+	var body interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	depth, path := jsonDepth(body, "")
+	if depth > n {
+		return fmt.Errorf("the response has a depth of %d at '%s', expected at most %d", depth, path, n)
+	}
+
+	return nil
+}
+
+func jsonDepth(v interface{}, path string) (int, string) {
+	deepest, deepestPath := 0, path
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			if d, p := jsonDepth(child, joinPath(path, k)); d > deepest {
+				deepest, deepestPath = d, p
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			if d, p := jsonDepth(child, joinPath(path, strconv.Itoa(i))); d > deepest {
+				deepest, deepestPath = d, p
+			}
+		}
+	default:
+		return 0, path
+	}
+
+	return deepest + 1, deepestPath
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func (s *ServerFeature) TheServerTimeShouldBeWithin(seconds int) error {
+	date := s.httpResponse.Header.Get("Date")
+	if date == "" {
+		return fmt.Errorf("response is missing a Date header")
+	}
+
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return fmt.Errorf("failed to parse Date header %q: %v", date, err)
+	}
+
+	skew := time.Since(serverTime)
+	log.Info().Msgf("server clock skew is %s", skew)
+
+	if skew.Abs() > time.Duration(seconds)*time.Second {
+		return fmt.Errorf("server clock is skewed by %s, expected within %ds", skew, seconds)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) SendSavedBodyAs(method, endpoint, savedKey string) error {
+	saved, ok := s.store[savedKey]
+	if !ok {
+		return fmt.Errorf("no value saved as '%s'", savedKey)
+	}
+
+	body, err := json.Marshal(saved)
+	if err != nil {
+		return fmt.Errorf("failed to marshal saved value '%s': %v", savedKey, err)
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	return s.Do(req)
+}
+
+func (s *ServerFeature) SetSavedFieldTo(savedKey, jsonQueryPath, value string) error {
+	saved, ok := s.store[savedKey]
+	if !ok {
+		return fmt.Errorf("no value saved as '%s'", savedKey)
+	}
+
+	updated, err := setPath(saved, strings.Split(jsonQueryPath, "."), s.ReplaceValues(value))
+	if err != nil {
+		return fmt.Errorf("failed to set '%s' on saved '%s': %v", jsonQueryPath, savedKey, err)
+	}
+
+	s.store[savedKey] = updated
+	return nil
+}
+
+func setPath(node interface{}, segments []string, value string) (interface{}, error) {
+	if len(segments) == 0 {
+		return coerceValue(node, value)
+	}
+
+	key := segments[0]
+	switch v := node.(type) {
+	case map[string]interface{}:
+		child, err := setPath(v[key], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[key] = child
+		return v, nil
+	case []interface{}:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, fmt.Errorf("invalid index '%s' for a list of %d items", key, len(v))
+		}
+		child, err := setPath(v[i], segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		v[i] = child
+		return v, nil
+	case nil:
+		child, err := setPath(nil, segments[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{key: child}, nil
+	default:
+		return nil, fmt.Errorf("cannot set '%s' on %v", key, v)
+	}
+}
+
+func coerceValue(current interface{}, value string) (interface{}, error) {
+	switch current.(type) {
+	case string:
+		return value, nil
+	case float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a number", value)
+		}
+		return f, nil
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a boolean", value)
+		}
+		return b, nil
+	}
+
+	var parsed interface{}
+	if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+		return value, nil
+	}
+
+	return parsed, nil
+}
+
+func (s *ServerFeature) TheResponseArrayShouldNotContainSavedItems(jsonQueryPath, savedKey, idField string) error {
+	saved, ok := s.store[savedKey].([]interface{})
+	if !ok {
+		return fmt.Errorf("saved value '%s' is not a list", savedKey)
+	}
+
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	actual, ok := val.Value().([]interface{})
+	if !ok {
+		return fmt.Errorf("the json query path %s is not a list: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	savedIDs := make(map[string]bool, len(saved))
+	for _, item := range saved {
+		savedIDs[itemID(item, idField)] = true
+	}
+
+	var overlap []string
+	for _, item := range actual {
+		if id := itemID(item, idField); savedIDs[id] {
+			overlap = append(overlap, id)
+		}
+	}
+
+	if len(overlap) > 0 {
+		return fmt.Errorf("the json query path %s contains saved items with %s %s", jsonQueryPath, idField, strings.Join(overlap, ", "))
+	}
+
+	return nil
+}
+
+func itemID(item interface{}, idField string) string {
+	if itemMap, ok := item.(map[string]interface{}); ok {
+		return fmt.Sprint(itemMap[idField])
+	}
+	return fmt.Sprint(item)
+}
+
+func (s *ServerFeature) TheResponseShouldOnlyContainFields(fields string) error {
+	var body interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	items, ok := body.([]interface{})
+	if !ok {
+		items = []interface{}{body}
+	}
+
+	expected := splitList(s.ReplaceValues(fields))
+	for i, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("item %d is not an object: %s", i, PrettifyJSON(s.responseBody))
+		}
+
+		if missing, unexpected := keyDifferences(itemMap, expected); len(missing) > 0 || len(unexpected) > 0 {
+			return fmt.Errorf("item %d is missing fields %v and has unexpected fields %v: %s", i, missing, unexpected, PrettifyJSON(s.responseBody))
+		}
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldHaveExactlyKeys(keys string) error {
+	body := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+		return fmt.Errorf("failed to unmarshal response into object: %v", err)
+	}
+
+	missing, unexpected := keyDifferences(body, splitList(s.ReplaceValues(keys)))
+
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("missing keys %v", missing))
+	}
+	if len(unexpected) > 0 {
+		problems = append(problems, fmt.Sprintf("unexpected keys %v", unexpected))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("response has %s: %s", strings.Join(problems, " and "), PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func keyDifferences(object map[string]interface{}, expected []string) (missing, unexpected []string) {
+	for _, key := range expected {
+		if _, ok := object[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	for key := range object {
+		if !slices.Contains(expected, key) {
+			unexpected = append(unexpected, key)
+		}
+	}
+	slices.Sort(unexpected)
+
+	return missing, unexpected
+}
+
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func (s *ServerFeature) TheResponseShouldHaveExpanded(jsonQueryPath string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := val.Value().(map[string]interface{}); !ok {
+		return fmt.Errorf("the json query path %s is not an embedded object: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldNotHaveExpanded(jsonQueryPath string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	switch val.Value().(type) {
+	case string, float64:
+		return nil
+	default:
+		return fmt.Errorf("the json query path %s is not a bare id: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+}
+
+// TheResponseShouldMatchBaselineWithinPercent compares the value at the json
+// query path against the JSON baseline persisted in baselineFile by an earlier
+// run with --update.
+func (s *ServerFeature) TheResponseShouldMatchBaselineWithinPercent(jsonQueryPath, baselineFile string, percent float64) error {
+	baselineFile = s.ReplaceValues(baselineFile)
+
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if viper.GetBool("update") {
+		content, err := json.MarshalIndent(val.Value(), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal baseline: %v", err)
+		}
+		if err = os.MkdirAll(filepath.Dir(baselineFile), 0o755); err != nil {
+			return fmt.Errorf("failed to create baseline directory: %v", err)
+		}
+
+		log.Info().Msgf("updating baseline %s", baselineFile)
+		if err = os.WriteFile(baselineFile, append(content, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write baseline %s: %v", baselineFile, err)
+		}
+		return nil
+	}
+
+	content, err := os.ReadFile(baselineFile)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline %s, run with --update to create it: %v", baselineFile, err)
+	}
+
+	var baseline interface{}
+	if err = json.Unmarshal(content, &baseline); err != nil {
+		return fmt.Errorf("baseline %s is not valid json: %v", baselineFile, err)
+	}
+
+	if diffs := diffJSON(jsonQueryPath, baseline, val.Value(), percent); len(diffs) > 0 {
+		return fmt.Errorf("the response drifted from baseline %s:\n%s", baselineFile, strings.Join(diffs, "\n"))
+	}
+
+	return nil
+}
+
+func diffJSON(path string, expected, actual interface{}, percent float64) []string {
+	label := path
+	if label == "" {
+		label = "(root)"
+	}
+
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected an object, got %v", label, actual)}
+		}
+
+		var diffs []string
+		for _, k := range slices.Sorted(maps.Keys(e)) {
+			if _, ok = a[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: missing", joinPath(path, k)))
+				continue
+			}
+			diffs = append(diffs, diffJSON(joinPath(path, k), e[k], a[k], percent)...)
+		}
+		for _, k := range slices.Sorted(maps.Keys(a)) {
+			if _, ok = e[k]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected", joinPath(path, k)))
+			}
+		}
+		return diffs
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected a list, got %v", label, actual)}
+		}
+		if len(a) != len(e) {
+			return []string{fmt.Sprintf("%s: expected %d items, got %d", label, len(e), len(a))}
+		}
+
+		var diffs []string
+		for i := range e {
+			diffs = append(diffs, diffJSON(joinPath(path, strconv.Itoa(i)), e[i], a[i], percent)...)
+		}
+		return diffs
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", label, e, actual)}
+		}
+		if math.Abs(a-e) > math.Abs(e)*percent/100 {
+			if percent == 0 {
+				return []string{fmt.Sprintf("%s: expected %v, got %v", label, e, a)}
+			}
+			return []string{fmt.Sprintf("%s: %v drifted from %v by more than %v%%", label, a, e, percent)}
+		}
+		return nil
+	default:
+		if !reflect.DeepEqual(expected, actual) {
+			return []string{fmt.Sprintf("%s: expected %v, got %v", label, expected, actual)}
+		}
+		return nil
+	}
+}
+
+func (s *ServerFeature) TheResponseFieldShouldBeValidEnum(jsonQueryPath, enumName string) error {
+	key := "enums." + enumName
+	if !viper.IsSet(key) {
+		return fmt.Errorf("no enum named '%s' is configured", enumName)
+	}
+
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	allowed := viper.GetStringSlice(key)
+	if actual := fmt.Sprint(val.Value()); !slices.Contains(allowed, actual) {
+		return fmt.Errorf("the json query path %s is %s, which is not a valid %s %v", jsonQueryPath, actual, enumName, allowed)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeAJWTWithClaim(jsonQueryPath, claim, value string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	segments := strings.Split(fmt.Sprint(val.Value()), ".")
+	if len(segments) != 3 {
+		return fmt.Errorf("the json query path %s is not a jwt: %v", jsonQueryPath, val.Value())
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segments[1], "="))
+	if err != nil {
+		return fmt.Errorf("failed to decode jwt payload in %s: %v", jsonQueryPath, err)
+	}
+
+	claims := make(map[string]interface{})
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return fmt.Errorf("failed to unmarshal jwt claims in %s: %v", jsonQueryPath, err)
+	}
+
+	actual, ok := lookupPath(claims, claim)
+	if !ok {
+		return fmt.Errorf("jwt in %s has no claim %s: %s", jsonQueryPath, claim, payload)
+	}
+
+	value = s.ReplaceValues(value)
+	if fmt.Sprint(actual) != value {
+		return fmt.Errorf("jwt claim %s in %s is %v, expected %s", claim, jsonQueryPath, actual, value)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeOneOf(jsonQueryPath, values string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	allowed := splitList(s.ReplaceValues(values))
+	if actual := fmt.Sprint(val.Value()); !slices.Contains(allowed, actual) {
+		return fmt.Errorf("the json query path %s is %s, expected one of %v", jsonQueryPath, actual, allowed)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldRoundTrip(createEndpoint, ignoreFields string) error {
+	original := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.responseBody), &original); err != nil {
+		return fmt.Errorf("failed to unmarshal response into object: %v", err)
+	}
+
+	ignored := splitList(ignoreFields)
+	for _, field := range ignored {
+		delete(original, field)
+	}
+
+	body, err := json.Marshal(original)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, createEndpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if err = s.Do(req); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("failed to create resource at %s, got %d: %s", createEndpoint, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	created := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(s.responseBody), &created); err != nil {
+		return fmt.Errorf("failed to unmarshal created resource: %v", err)
+	}
+
+	id, ok := created["id"]
+	if !ok {
+		return fmt.Errorf("created resource has no id: %s", PrettifyJSON(s.responseBody))
+	}
+
+	if err = s.SendRequest(http.MethodGet, fmt.Sprintf("%s/%s", strings.TrimSuffix(createEndpoint, "/"), formatJSONValue(id))); err != nil {
+		return err
+	}
+
+	fetched := make(map[string]interface{})
+	if err = json.Unmarshal([]byte(s.responseBody), &fetched); err != nil {
+		return fmt.Errorf("failed to unmarshal fetched resource: %v", err)
+	}
+
+	for _, field := range ignored {
+		delete(fetched, field)
+	}
+
+	if diffs := diffJSON("", original, fetched, 0); len(diffs) > 0 {
+		return fmt.Errorf("resource did not round trip through %s:\n%s", createEndpoint, strings.Join(diffs, "\n"))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseFieldShouldEqualRequestField(responsePath, requestPath string) error {
+	return s.TheResponseFieldShouldEqualTransformedRequestField(responsePath, "", requestPath)
+}
+
+func (s *ServerFeature) TheResponseFieldShouldEqualTransformedRequestField(responsePath, transform, requestPath string) error {
+	var requestBody interface{}
+	if err := json.Unmarshal([]byte(s.lastRequest.body), &requestBody); err != nil {
+		return fmt.Errorf("failed to unmarshal last request body: %v", err)
+	}
+
+	requestValue, ok := lookupPath(requestBody, requestPath)
+	if !ok {
+		return fmt.Errorf("'%s' not found in request: %s", requestPath, PrettifyJSON(s.lastRequest.body))
+	}
+
+	val, err := s.GetNodeFromResponse(responsePath)
+	if err != nil {
+		return err
+	}
+
+	expected := fmt.Sprint(requestValue)
+	switch transform {
+	case "lowercase":
+		expected = strings.ToLower(expected)
+	case "uppercase":
+		expected = strings.ToUpper(expected)
+	case "trimmed":
+		expected = strings.TrimSpace(expected)
+	case "slugified":
+		expected = slugify(expected)
+	}
+
+	if actual := fmt.Sprint(val.Value()); actual != expected {
+		return fmt.Errorf("the json query path %s is %s, expected %s from request %s", responsePath, actual, expected, requestPath)
+	}
+
+	return nil
+}
+
+func lookupPath(v interface{}, path string) (interface{}, bool) {
+	for _, segment := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			child, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			v = child
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func slugify(input string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(input)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func (s *ServerFeature) TheResponseShouldNotBeCacheable() error {
+	cacheControl := s.httpResponse.Header.Get("Cache-Control")
+
+	directives := make(map[string]bool)
+	for _, directive := range splitList(strings.ToLower(cacheControl)) {
+		name, _, _ := strings.Cut(directive, "=")
+		directives[strings.TrimSpace(name)] = true
+	}
+
+	accepted := viper.GetStringSlice("no_cache_directives")
+	for _, set := range accepted {
+		satisfied := true
+		for _, directive := range splitList(strings.ToLower(set)) {
+			if !directives[directive] {
+				satisfied = false
+				break
+			}
+		}
+		if satisfied {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the Cache-Control header %q does not satisfy any of %q", cacheControl, accepted)
+}
+
+func (s *ServerFeature) ResponseTimesShouldBeConsistent(method, endpoint1, endpoint2 string, toleranceMs int) error {
+	first, err := s.medianResponseTime(method, endpoint1)
+	if err != nil {
+		return err
+	}
+
+	second, err := s.medianResponseTime(method, endpoint2)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("median response times: %s took %s, %s took %s", endpoint1, first, endpoint2, second)
+
+	if (first - second).Abs() > time.Duration(toleranceMs)*time.Millisecond {
+		return fmt.Errorf("median response times differ by more than %dms: %s took %s, %s took %s", toleranceMs, endpoint1, first, endpoint2, second)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) medianResponseTime(method, endpoint string) (time.Duration, error) {
+	durations := make([]time.Duration, max(viper.GetInt("timing_samples"), 1))
+	for i := range durations {
+		if err := s.SendRequest(method, s.ReplaceValues(endpoint)); err != nil {
+			return 0, err
+		}
+		durations[i] = s.responseDuration
+	}
+
+	slices.Sort(durations)
+	return durations[len(durations)/2], nil
+}
+
+func (s *ServerFeature) TheResponseShouldEchoRequestID() error {
+	if path := viper.GetString("request_id_response_path"); path != "" {
+		return s.TheResponseShouldContainSetTo(path, s.lastRequest.requestID)
+	}
+
+	header := viper.GetString("request_id_header")
+	if actual := s.httpResponse.Header.Get(header); actual != s.lastRequest.requestID {
+		return fmt.Errorf("expected %s header %q to be echoed, got %q", header, s.lastRequest.requestID, actual)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheListShouldBeInCreationOrder(listEndpoint, idField string) error {
+	return s.listShouldFollowCreationOrder(listEndpoint, idField, false)
+}
+
+func (s *ServerFeature) TheListShouldBeInReverseCreationOrder(listEndpoint, idField string) error {
+	return s.listShouldFollowCreationOrder(listEndpoint, idField, true)
+}
+
+func (s *ServerFeature) TheResponseShouldBeSortedAscendingBy(jsonQueryPath, field string) error {
+	return s.responseShouldBeSortedBy(jsonQueryPath, field, false)
+}
+
+func (s *ServerFeature) TheResponseShouldBeSortedDescendingBy(jsonQueryPath, field string) error {
+	return s.responseShouldBeSortedBy(jsonQueryPath, field, true)
+}
+
+func (s *ServerFeature) responseShouldBeSortedBy(jsonQueryPath, field string, descending bool) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	items, ok := val.Value().([]interface{})
+	if !ok {
+		return fmt.Errorf("the json query path %s is not an array: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	order := "ascending"
+	if descending {
+		order = "descending"
+	}
+
+	var previous interface{}
+	for i, item := range items {
+		current, ok := lookupPath(item, field)
+		if !ok {
+			return fmt.Errorf("item %d in %s has no %s", i, jsonQueryPath, field)
+		}
+
+		if i > 0 {
+			c := compareValues(previous, current)
+			if descending {
+				c = -c
+			}
+			if c > 0 {
+				return fmt.Errorf("%s is not sorted %s by %s: item %d (%v) comes before item %d (%v)", jsonQueryPath, order, field, i-1, previous, i, current)
+			}
+		}
+		previous = current
+	}
+
+	return nil
+}
+
+func compareValues(a, b interface{}) int {
+	x, aNumber := a.(float64)
+	y, bNumber := b.(float64)
+	if aNumber && bNumber {
+		return cmp.Compare(x, y)
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func (s *ServerFeature) listShouldFollowCreationOrder(listEndpoint, idField string, reverse bool) error {
+	var createdIDs []string
+	for _, body := range s.createdBodies {
+		created := make(map[string]interface{})
+		if err := json.Unmarshal([]byte(body), &created); err != nil {
+			continue
+		}
+		if id, ok := created[idField]; ok {
+			createdIDs = append(createdIDs, fmt.Sprint(id))
+		}
+	}
+
+	if len(createdIDs) < 2 {
+		return fmt.Errorf("need at least two created resources with %s to check ordering, found %d", idField, len(createdIDs))
+	}
+
+	if reverse {
+		slices.Reverse(createdIDs)
+	}
+
+	if err := s.SendRequest(http.MethodGet, s.ReplaceValues(listEndpoint)); err != nil {
+		return err
+	}
+
+	items := make([]interface{}, 0)
+	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil {
+		return fmt.Errorf("failed to unmarshal response into list: %v", err)
+	}
+
+	listed := make([]string, len(items))
+	for i, item := range items {
+		listed[i] = itemID(item, idField)
+	}
+
+	previous := -1
+	for i, id := range createdIDs {
+		position := slices.Index(listed, id)
+		if position == -1 {
+			return fmt.Errorf("created resource %s is missing from %s: %s", id, listEndpoint, PrettifyJSON(s.responseBody))
+		}
+		if position < previous {
+			return fmt.Errorf("created resource %s is listed before %s in %s", id, createdIDs[i-1], listEndpoint)
+		}
+		previous = position
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) PatchShouldOnlyChange(endpoint, changedFields string, patch *godog.DocString) error {
+	endpoint = s.ReplaceValues(endpoint)
+
+	before, err := s.fetchObject(endpoint)
+	if err != nil {
+		return err
+	}
+
+	if err = s.SendRequestWithData(http.MethodPatch, endpoint, patch); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("failed to patch %s, got %d: %s", endpoint, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	after, err := s.fetchObject(endpoint)
+	if err != nil {
+		return err
+	}
+
+	expected := splitList(changedFields)
+	allowed := append(slices.Clone(expected), "updatedAt", "updated_at")
+
+	fields := maps.Clone(before)
+	maps.Copy(fields, after)
+
+	var unexpected, unchanged []string
+	for _, k := range slices.Sorted(maps.Keys(fields)) {
+		if !reflect.DeepEqual(before[k], after[k]) && !slices.Contains(allowed, k) {
+			unexpected = append(unexpected, fmt.Sprintf("%s changed from %v to %v", k, before[k], after[k]))
+		}
+	}
+	for _, field := range expected {
+		if reflect.DeepEqual(before[field], after[field]) {
+			unchanged = append(unchanged, field)
+		}
+	}
+
+	if len(unexpected) > 0 || len(unchanged) > 0 {
+		return fmt.Errorf("patch changed unexpected fields %v and left expected fields unchanged %v", unexpected, unchanged)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) fetchObject(endpoint string) (map[string]interface{}, error) {
+	if err := s.SendRequest(http.MethodGet, endpoint); err != nil {
+		return nil, err
+	}
+
+	if s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("failed to fetch %s, got %d: %s", endpoint, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	object := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.responseBody), &object); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response into object: %v", err)
+	}
+
+	return object, nil
+}
+
+func (s *ServerFeature) ErrorsShouldBeConsistent(table *godog.Table) error {
+	required := viper.GetStringSlice("error_fields")
+
+	var nonconforming []string
+	for _, row := range tableRows(table, "method") {
+		if len(row) < 3 {
+			return fmt.Errorf("each error needs a method, an endpoint and a status, got %v", row)
+		}
+
+		method, endpoint := row[0], s.ReplaceValues(row[1])
+		status, err := strconv.Atoi(row[2])
+		if err != nil {
+			return fmt.Errorf("invalid status %q for %s %s: %v", row[2], method, endpoint, err)
+		}
+
+		if err = s.SendRequest(method, endpoint); err != nil {
+			return err
+		}
+
+		if s.httpResponse.StatusCode != status {
+			nonconforming = append(nonconforming, fmt.Sprintf("%s %s returned %d, expected %d", method, endpoint, s.httpResponse.StatusCode, status))
+			continue
+		}
+
+		body := make(map[string]interface{})
+		if err = json.Unmarshal([]byte(s.responseBody), &body); err != nil {
+			nonconforming = append(nonconforming, fmt.Sprintf("%s %s returned a body that is not an object: %s", method, endpoint, s.responseBody))
+			continue
+		}
+
+		var missing []string
+		for _, field := range required {
+			if _, ok := body[field]; !ok {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			nonconforming = append(nonconforming, fmt.Sprintf("%s %s is missing %v", method, endpoint, missing))
+		}
+	}
+
+	if len(nonconforming) > 0 {
+		return fmt.Errorf("error responses do not match the configured structure %v:\n%s", required, strings.Join(nonconforming, "\n"))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) AddingParamShouldNotChangeResults(method, endpoint, param, value, comparePath string) error {
+	endpoint = s.ReplaceValues(endpoint)
+
+	if err := s.SendRequest(method, endpoint); err != nil {
+		return err
+	}
+
+	without, err := s.GetNodeFromResponse(comparePath)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	q := req.URL.Query()
+	q.Set(param, s.ReplaceValues(value))
+	req.URL.RawQuery = q.Encode()
+
+	if err = s.Do(req); err != nil {
+		return err
+	}
+
+	with, err := s.GetNodeFromResponse(comparePath)
+	if err != nil {
+		return err
+	}
+
+	if diffs := diffJSON(comparePath, without.Value(), with.Value(), 0); len(diffs) > 0 {
+		return fmt.Errorf("adding %s=%s changed the results:\n%s", param, value, strings.Join(diffs, "\n"))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseHeaderShouldBe(name, value string) error {
+	value = s.ReplaceValues(value)
+
+	if actual := s.httpResponse.Header.Get(name); actual != value {
+		return fmt.Errorf("expected header %s to be %q, got %q", name, value, actual)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldRedirectTo(expected string) error {
+	expected = s.ReplaceValues(expected)
+
+	if s.httpResponse.StatusCode < http.StatusMultipleChoices || s.httpResponse.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("expected a redirect, got %d", s.httpResponse.StatusCode)
+	}
+
+	location := s.httpResponse.Header.Get("Location")
+	if location == expected {
+		return nil
+	}
+
+	target, err := s.httpResponse.Request.URL.Parse(location)
+	if err != nil {
+		return fmt.Errorf("invalid Location header %q: %v", location, err)
+	}
+
+	if target.String() != expected && target.RequestURI() != expected {
+		return fmt.Errorf("expected a redirect to %s, got %q", expected, location)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseContentTypeShouldBe(expected string) error {
+	contentType := s.httpResponse.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("failed to parse content type %q: %v", contentType, err)
+	}
+
+	if !strings.EqualFold(mediaType, expected) {
+		return fmt.Errorf("expected content type %s, got %q", expected, contentType)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldHaveHeader(name string) error {
+	if len(s.httpResponse.Header.Values(name)) == 0 {
+		return fmt.Errorf("response does not have header %s", name)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseHashShouldBe(hash string) error {
+	hash = s.ReplaceValues(hash)
+
+	if actual := s.responseHash(); actual != hash {
+		return fmt.Errorf("expected response hash %s, got %s: %s", hash, actual, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) SaveResponseHash(key string) error {
+	s.store[key] = s.responseHash()
+	return nil
+}
+
+func (s *ServerFeature) responseHash() string {
+	normalized := strings.Join(strings.Fields(s.responseBody), " ")
+
+	var body interface{}
+	decoder := json.NewDecoder(strings.NewReader(s.responseBody))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err == nil && decoder.Decode(new(interface{})) == io.EOF {
+		if compact, err := json.Marshal(body); err == nil {
+			normalized = string(compact)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *ServerFeature) SendWithContentType(method, endpoint, contentType string, body *godog.DocString) error {
+	req, err := http.NewRequest(method, endpoint, s.PrepareBody(body.Content))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return s.Do(req)
+}
+
+func (s *ServerFeature) TheServerShouldRejectPlainText(method, endpoint string, body *godog.DocString) error {
+	if err := s.SendWithContentType(method, endpoint, "text/plain", body); err != nil {
+		return err
+	}
+
+	return s.TheResponseCodeShouldBe(http.StatusUnsupportedMediaType)
+}
+
+func (s *ServerFeature) TheResponseShouldBeGreaterThan(jsonQueryPath string, expected float64) error {
+	return s.compareNumber(jsonQueryPath, expected, "greater than", func(actual, expected float64) bool {
+		return actual > expected
+	})
+}
+
+func (s *ServerFeature) TheResponseShouldBeLessThan(jsonQueryPath string, expected float64) error {
+	return s.compareNumber(jsonQueryPath, expected, "less than", func(actual, expected float64) bool {
+		return actual < expected
+	})
+}
+
+func (s *ServerFeature) TheResponseShouldBeAtLeast(jsonQueryPath string, expected float64) error {
+	return s.compareNumber(jsonQueryPath, expected, "at least", func(actual, expected float64) bool {
+		return actual >= expected
+	})
+}
+
+func (s *ServerFeature) TheResponseShouldBeAtMost(jsonQueryPath string, expected float64) error {
+	return s.compareNumber(jsonQueryPath, expected, "at most", func(actual, expected float64) bool {
+		return actual <= expected
+	})
+}
+
+func (s *ServerFeature) TheResponseShouldBeOfType(jsonQueryPath, expected string) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if actual := jsonType(val.Value()); actual != expected {
+		return fmt.Errorf("the json query path %s is a %s, expected a %s: %s", jsonQueryPath, actual, expected, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeTrue(jsonQueryPath string) error {
+	return s.responseShouldBeBool(jsonQueryPath, true)
+}
+
+func (s *ServerFeature) TheResponseShouldBeFalse(jsonQueryPath string) error {
+	return s.responseShouldBeBool(jsonQueryPath, false)
+}
+
+func (s *ServerFeature) responseShouldBeBool(jsonQueryPath string, expected bool) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	actual, ok := val.Value().(bool)
+	if !ok {
+		return fmt.Errorf("the json query path %s is not a boolean: %v", jsonQueryPath, val.Value())
+	}
+
+	if actual != expected {
+		return fmt.Errorf("the json query path %s is %t, expected %t", jsonQueryPath, actual, expected)
+	}
+
+	return nil
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func (s *ServerFeature) TheResponseShouldBeApproximately(jsonQueryPath string, expected, tolerance float64) error {
+	actual, err := s.responseNumber(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if math.Abs(actual-expected) > tolerance {
+		return fmt.Errorf("the json query path %s is %v, expected %v within %v", jsonQueryPath, actual, expected, tolerance)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) compareNumber(jsonQueryPath string, expected float64, comparison string, compare func(actual, expected float64) bool) error {
+	actual, err := s.responseNumber(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if !compare(actual, expected) {
+		return fmt.Errorf("the json query path %s is %v, expected %s %v", jsonQueryPath, actual, comparison, expected)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) responseNumber(jsonQueryPath string) (float64, error) {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return 0, err
+	}
+
+	actual, err := strconv.ParseFloat(fmt.Sprint(val.Value()), 64)
+	if err != nil {
+		return 0, fmt.Errorf("the json query path %s is not numeric: %v", jsonQueryPath, val.Value())
+	}
+
+	return actual, nil
+}
+
+func (s *ServerFeature) TheResponseFieldShouldMeetSLA(jsonQueryPath, slaName string) error {
+	key := "sla." + slaName
+	if !viper.IsSet(key) {
+		return fmt.Errorf("no sla named '%s' is configured", slaName)
+	}
+
+	actual, err := s.responseNumber(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if viper.IsSet(key+".min") && actual < viper.GetFloat64(key+".min") {
+		return fmt.Errorf("the json query path %s is %v, below the %s minimum of %v", jsonQueryPath, actual, slaName, viper.GetFloat64(key+".min"))
+	}
+
+	if viper.IsSet(key+".max") && actual > viper.GetFloat64(key+".max") {
+		return fmt.Errorf("the json query path %s is %v, above the %s maximum of %v", jsonQueryPath, actual, slaName, viper.GetFloat64(key+".max"))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) CreatedResourceShouldBeFindableBy(createEndpoint, lookupTemplate, lookupField string, body *godog.DocString) error {
+	if err := s.SendRequestWithData(http.MethodPost, createEndpoint, body); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("failed to create resource at %s, got %d: %s", createEndpoint, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	if err := s.SaveValueFromResponse(lookupField); err != nil {
+		return err
+	}
+	value := fmt.Sprint(s.store[lookupField])
+
+	lookupEndpoint := s.ReplaceValues(lookupTemplate)
+	if err := s.SendRequest(http.MethodGet, lookupEndpoint); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to find resource by %s at %s, got %d: %s", lookupField, lookupEndpoint, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	return s.TheResponseShouldContainSetTo(lookupField, value)
+}
+
+func (s *ServerFeature) ConcurrentUpdatesShouldConverge(endpoint, finalPath, expected string, updates *godog.Table) error {
+	endpoint = s.ReplaceValues(endpoint)
+
+	var requests []*http.Request
+	for _, row := range tableRows(updates, "method") {
+		if len(row) < 2 {
+			return fmt.Errorf("each update needs a method and a body, got %v", row)
+		}
+
+		req, err := http.NewRequest(row[0], endpoint, strings.NewReader(row[1]))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %v", err)
+		}
+
+		s.prepareRequest(req)
+		requests = append(requests, req)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(requests))
+	for i, req := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			response, err := s.client.Do(req)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to make request: %v", err)
+				return
+			}
+			defer response.Body.Close()
+
+			body, _ := io.ReadAll(response.Body)
+			if response.StatusCode >= http.StatusMultipleChoices && response.StatusCode != http.StatusConflict {
+				errs[i] = fmt.Errorf("%s %s failed with %d: %s", req.Method, endpoint, response.StatusCode, PrettifyJSON(string(body)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	if err := s.SendRequest(http.MethodGet, endpoint); err != nil {
+		return err
+	}
+
+	val, err := s.GetNodeFromResponse(finalPath)
+	if err != nil {
+		return err
+	}
+
+	allowed := splitList(s.ReplaceValues(expected))
+	if actual := fmt.Sprint(val.Value()); !slices.Contains(allowed, actual) {
+		return fmt.Errorf("the json query path %s converged to %s, expected one of %v", finalPath, actual, allowed)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeJSONAPI() error {
+	contentType := s.httpResponse.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/vnd.api+json" {
+		return fmt.Errorf("expected content type application/vnd.api+json, got %q", contentType)
+	}
+
+	document := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.responseBody), &document); err != nil {
+		return fmt.Errorf("failed to unmarshal response into object: %v", err)
+	}
+
+	_, hasData := document["data"]
+	_, hasErrors := document["errors"]
+	_, hasMeta := document["meta"]
+	if !hasData && !hasErrors && !hasMeta {
+		return fmt.Errorf("response must contain data, errors or meta: %s", PrettifyJSON(s.responseBody))
+	} else if hasData && hasErrors {
+		return fmt.Errorf("response must not contain both data and errors: %s", PrettifyJSON(s.responseBody))
+	}
+
+	resources, err := jsonAPIResources(document)
+	if err != nil {
+		return err
+	}
+
+	for i, resource := range resources {
+		if _, ok := resource["type"].(string); !ok {
+			return fmt.Errorf("resource %d is missing a type: %s", i, PrettifyJSON(s.responseBody))
+		}
+		if _, ok := resource["id"].(string); !ok {
+			return fmt.Errorf("resource %d is missing a string id: %s", i, PrettifyJSON(s.responseBody))
+		}
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheJSONAPIResourceTypeShouldBe(resourceType string) error {
+	document := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.responseBody), &document); err != nil {
+		return fmt.Errorf("failed to unmarshal response into object: %v", err)
+	}
+
+	resources, err := jsonAPIResources(document)
+	if err != nil {
+		return err
+	}
+
+	if len(resources) == 0 {
+		return fmt.Errorf("response contains no resources: %s", PrettifyJSON(s.responseBody))
+	}
+
+	for i, resource := range resources {
+		if actual := fmt.Sprint(resource["type"]); actual != resourceType {
+			return fmt.Errorf("resource %d has type %s, expected %s", i, actual, resourceType)
+		}
+	}
+
+	return nil
+}
+
+func jsonAPIResources(document map[string]interface{}) ([]map[string]interface{}, error) {
+	var items []interface{}
+	switch data := document["data"].(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		items = []interface{}{data}
+	case []interface{}:
+		items = data
+	default:
+		return nil, fmt.Errorf("data must be an object, a list or null, got %v", data)
+	}
+
+	resources := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		resource, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("resource %d is not an object: %v", i, item)
+		}
+		resources[i] = resource
+	}
+
+	return resources, nil
+}
+
+func (s *ServerFeature) TheResponseShouldHaveLink(rel string) error {
+	_, err := s.responseLink(rel)
+	return err
+}
+
+func (s *ServerFeature) FollowResponseLink(rel, method string) error {
+	href, err := s.responseLink(rel)
+	if err != nil {
+		return err
+	}
+
+	link, err := url.Parse(href)
+	if err != nil {
+		return fmt.Errorf("invalid href %q for link %s: %v", href, rel, err)
+	}
+
+	return s.SendRequest(method, s.httpResponse.Request.URL.ResolveReference(link).String())
+}
+
+func (s *ServerFeature) responseLink(rel string) (string, error) {
+	document := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(s.responseBody), &document); err != nil {
+		return "", fmt.Errorf("failed to unmarshal response into object: %v", err)
+	}
+
+	linksKey := viper.GetString("links_key")
+	links, ok := document[linksKey].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("response has no %s object: %s", linksKey, PrettifyJSON(s.responseBody))
+	}
+
+	link := links[rel]
+	if list, ok := link.([]interface{}); ok && len(list) > 0 {
+		link = list[0]
+	}
+
+	linkMap, ok := link.(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("response has no %s link: %s", rel, PrettifyJSON(s.responseBody))
+	}
+
+	href, ok := linkMap["href"].(string)
+	if !ok || href == "" {
+		return "", fmt.Errorf("link %s has no href: %s", rel, PrettifyJSON(s.responseBody))
+	}
+
+	return href, nil
+}
+
+func (s *ServerFeature) SaveFieldToPersistentBaseline(jsonQueryPath, baselineFile string) error {
+	actual, err := s.responseNumber(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	return writeBaseline(s.ReplaceValues(baselineFile), actual)
+}
+
+func (s *ServerFeature) TheFieldShouldNotBeLessThanBaseline(jsonQueryPath, baselineFile string) error {
+	baselineFile = s.ReplaceValues(baselineFile)
+
+	actual, err := s.responseNumber(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(baselineFile)
+	if err != nil {
+		return fmt.Errorf("failed to read baseline %s: %v", baselineFile, err)
+	}
+
+	baseline, err := strconv.ParseFloat(strings.TrimSpace(string(content)), 64)
+	if err != nil {
+		return fmt.Errorf("baseline %s is not numeric: %v", baselineFile, err)
+	}
+
+	if actual < baseline {
+		return fmt.Errorf("the json query path %s regressed to %v, below the baseline of %v", jsonQueryPath, actual, baseline)
+	}
+
+	if actual > baseline && viper.GetBool("update_baselines") {
+		log.Info().Msgf("raising baseline %s from %v to %v", baselineFile, baseline, actual)
+		return writeBaseline(baselineFile, actual)
+	}
+
+	return nil
+}
+
+func writeBaseline(baselineFile string, value float64) error {
+	if err := os.MkdirAll(filepath.Dir(baselineFile), 0o755); err != nil {
+		return fmt.Errorf("failed to create baseline directory: %v", err)
+	}
+
+	if err := os.WriteFile(baselineFile, []byte(strconv.FormatFloat(value, 'f', -1, 64)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write baseline %s: %v", baselineFile, err)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheArrayFieldShouldHaveNDistinctValues(jsonQueryPath, field string, n int) error {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	items, ok := val.Value().([]interface{})
+	if !ok {
+		return fmt.Errorf("the json query path %s is not a list: %s", jsonQueryPath, PrettifyJSON(s.responseBody))
+	}
+
+	distinct := make(map[string]bool)
+	for _, item := range items {
+		distinct[itemID(item, field)] = true
+	}
+
+	if len(distinct) != n {
+		return fmt.Errorf("the json query path %s has %d distinct %s values %v, expected %d", jsonQueryPath, len(distinct), field, slices.Sorted(maps.Keys(distinct)), n)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeAJSONArray() error {
+	var items []interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &items); err != nil || items == nil {
+		return fmt.Errorf("response is not a json array: %s", PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldBeAJSONObject() error {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &object); err != nil || object == nil {
+		return fmt.Errorf("response is not a json object: %s", PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseETagShouldMatchBodyHash() error {
+	etag := s.httpResponse.Header.Get("ETag")
+	if etag == "" {
+		return fmt.Errorf("response is missing an ETag header")
+	} else if strings.HasPrefix(etag, "W/") {
+		return fmt.Errorf("weak ETag %s is not a content hash", etag)
+	}
+
+	var h hash.Hash
+	switch algorithm := viper.GetString("etag_algorithm"); algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("unsupported etag_algorithm %s", algorithm)
+	}
+
+	h.Write([]byte(s.responseBody))
+	sum := h.Sum(nil)
+
+	value := strings.Trim(etag, `"`)
+	for _, expected := range []string{hex.EncodeToString(sum), base64.StdEncoding.EncodeToString(sum), base64.RawURLEncoding.EncodeToString(sum)} {
+		if value == expected {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("ETag %s does not match the %s of the body, expected %s", etag, viper.GetString("etag_algorithm"), hex.EncodeToString(sum))
+}
+
+func (s *ServerFeature) TheEnvironmentShouldBeHealthy(healthEndpoint string) error {
+	healthURL := s.FormatURL(s.ReplaceValues(healthEndpoint)).String()
+
+	healthChecksMu.Lock()
+	defer healthChecksMu.Unlock()
+
+	if err, ok := healthChecks[healthURL]; ok {
+		return err
+	}
+
+	err := s.checkHealth(healthURL)
+	healthChecks[healthURL] = err
+	return err
+}
+
+func (s *ServerFeature) checkHealth(healthURL string) error {
+	lifecycle := viper.GetString("lifecycle")
+
+	response, err := s.client.Get(healthURL)
+	if err != nil {
+		return fmt.Errorf("%s environment is not reachable at %s: %v", lifecycle, healthURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(response.Body)
+		return fmt.Errorf("%s environment is unhealthy at %s, got %d: %s", lifecycle, healthURL, response.StatusCode, PrettifyJSON(string(body)))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheFieldShouldIncrementByOne(jsonQueryPath, actionMethod, actionEndpoint string) error {
+	fetchURL := s.lastRequest.url
+	if fetchURL == "" {
+		return fmt.Errorf("no request has been sent to fetch %s from", jsonQueryPath)
+	}
+
+	before, err := s.responseInt(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if err = s.SendRequest(actionMethod, s.ReplaceValues(actionEndpoint)); err != nil {
+		return err
+	}
+
+	if s.httpResponse.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("%s %s failed with %d: %s", actionMethod, actionEndpoint, s.httpResponse.StatusCode, PrettifyJSON(s.responseBody))
+	}
+
+	if err = s.SendRequest(http.MethodGet, fetchURL); err != nil {
+		return err
+	}
+
+	after, err := s.responseInt(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if after != before+1 {
+		return fmt.Errorf("the json query path %s went from %d to %d, expected %d", jsonQueryPath, before, after, before+1)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) responseInt(jsonQueryPath string) (int64, error) {
+	node, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return 0, err
+	}
+
+	raw, err := json.Marshal(node.Value())
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal the json query path %s: %v", jsonQueryPath, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var val interface{}
+	if err = decoder.Decode(&val); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal the json query path %s: %v", jsonQueryPath, err)
+	}
+
+	number, ok := val.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("the json query path %s is not a number: %v", jsonQueryPath, val)
+	}
+
+	i, err := number.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("the json query path %s is not an integer: %v", jsonQueryPath, number)
+	}
+
+	return i, nil
+}
+
+func (s *ServerFeature) TheResponseFieldShouldMatchRegex(jsonQueryPath, pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid regex %s: %v", pattern, err)
+	}
+
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	if actual := fmt.Sprint(val.Value()); !re.MatchString(actual) {
+		return fmt.Errorf("the json query path %s is %q, which does not match %s", jsonQueryPath, actual, pattern)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseFieldShouldBeASignedURL(jsonQueryPath string) error {
+	_, err := s.signedURL(jsonQueryPath)
+	return err
+}
+
+func (s *ServerFeature) TheSignedURLShouldBeFetchable(jsonQueryPath string) error {
+	signedURL, err := s.signedURL(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.client.Head(signedURL.String())
+	if err != nil {
+		return fmt.Errorf("failed to fetch signed url %s: %v", signedURL, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("signed url %s returned %d", signedURL, response.StatusCode)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) signedURL(jsonQueryPath string) (*url.URL, error) {
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return nil, err
+	}
+
+	signedURL, err := url.Parse(fmt.Sprint(val.Value()))
+	if err != nil || signedURL.Host == "" {
+		return nil, fmt.Errorf("the json query path %s is not an absolute url: %v", jsonQueryPath, val.Value())
+	}
+
+	query := signedURL.Query()
+	for _, param := range viper.GetStringSlice("signed_url_params") {
+		if !query.Has(param) {
+			return nil, fmt.Errorf("signed url %s is missing the %s parameter", signedURL, param)
+		}
+	}
+
+	return signedURL, nil
+}
+
+func (s *ServerFeature) TheResponseFieldShouldMatchSQL(jsonQueryPath string, query *godog.DocString) error {
+	if s.db == nil {
+		return fmt.Errorf("no database registered, call SetDB on the fixture")
+	}
+
+	val, err := s.GetNodeFromResponse(jsonQueryPath)
+	if err != nil {
+		return err
+	}
+
+	var result interface{}
+	if err = s.db.QueryRow(s.ReplaceValues(query.Content)).Scan(&result); err != nil {
+		return fmt.Errorf("failed to query database: %v", err)
+	}
+
+	if b, ok := result.([]byte); ok {
+		result = string(b)
+	}
+
+	actual, expected := fmt.Sprint(val.Value()), fmt.Sprint(result)
+	if actual == expected {
+		return nil
+	}
+
+	actualNumber, actualErr := strconv.ParseFloat(actual, 64)
+	expectedNumber, expectedErr := strconv.ParseFloat(expected, 64)
+	if actualErr == nil && expectedErr == nil && actualNumber == expectedNumber {
+		return nil
+	}
+
+	return fmt.Errorf("the json query path %s is %s, but the database has %s", jsonQueryPath, actual, expected)
+}
+
+func (s *ServerFeature) TheResponseShouldSetCookie(name string) error {
+	for _, cookie := range s.httpResponse.Cookies() {
+		if cookie.Name == name {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("response does not set cookie %s", name)
+}
+
+func (s *ServerFeature) TheResponseShouldStreamAtLeast(n int, withinSeconds int) error {
+	window := time.Duration(withinSeconds) * time.Second
+
+	var arrived []time.Duration
+	for _, arrival := range s.streamArrivals {
+		if arrival <= window {
+			arrived = append(arrived, arrival)
+		}
+	}
+
+	if len(arrived) < n {
+		return fmt.Errorf("expected at least %d lines within %s, received %d of %d", n, window, len(arrived), len(s.streamArrivals))
 	}
 
-	if index >= len(items) {
-		return fmt.Errorf("not enough items in response to get item at index %d, found %d", index, len(items))
+	if n > 1 && arrived[0] == arrived[len(arrived)-1] {
+		return fmt.Errorf("all %d lines arrived at once after %s, the response appears to be buffered", len(arrived), arrived[0])
 	}
 
-	itemMap := items[index].(map[string]interface{})
-	itemValue := fmt.Sprint(itemMap[property])
-	if itemValue != value {
-		return fmt.Errorf("item at index %d does not have %s set to %s, found %s", index, property, value, itemValue)
+	return nil
+}
+
+func (s *ServerFeature) TheResponseErrorMessageShouldBe(message string) error {
+	message = s.ReplaceValues(message)
+
+	if s.response.Error != message {
+		return fmt.Errorf("expected error message %q, got %q: %s", message, s.response.Error, PrettifyJSON(s.responseBody))
 	}
 
 	return nil
 }
 
-func (s *ServerFeature) SaveValueFromResponse(key string) error {
-	val, err := s.GetNodeFromResponse(key)
+func (s *ServerFeature) TheResponseErrorMessageShouldContain(message string) error {
+	message = s.ReplaceValues(message)
+
+	if !strings.Contains(s.response.Error, message) {
+		return fmt.Errorf("expected error message to contain %q, got %q: %s", message, s.response.Error, PrettifyJSON(s.responseBody))
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseBodySizeShouldBeLessThan(size int) error {
+	if len(s.responseBody) >= size {
+		return fmt.Errorf("response body is %d bytes, expected smaller than %d", len(s.responseBody), size)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseBodySizeShouldBeGreaterThan(size int) error {
+	if len(s.responseBody) <= size {
+		return fmt.Errorf("response body is %d bytes, expected larger than %d: %s", len(s.responseBody), size, s.responseBody)
+	}
+
+	return nil
+}
+
+func (s *ServerFeature) TheResponseShouldHaveNDJSONLines(count int) error {
+	lines, err := s.ndjsonLines()
 	if err != nil {
 		return err
 	}
 
-	s.store[key] = val.Value()
+	if len(lines) != count {
+		return fmt.Errorf("the response has %d ndjson lines, expected %d: %s", len(lines), count, s.responseBody)
+	}
+
 	return nil
 }
 
-func (s *ServerFeature) SaveValueFromResponseList(index int, key, value string) error {
-	val, err := s.GetNodeFromResponse(key)
+func (s *ServerFeature) TheNDJSONLineShouldContainSetTo(line int, jsonQueryPath, value string) error {
+	lines, err := s.ndjsonLines()
 	if err != nil {
 		return err
 	}
 
-	if index >= len(val.ChildNodes()) {
-		return fmt.Errorf("not enough items in response to get item at index %d, found %d", index, len(val.ChildNodes()))
+	if line < 1 || line > len(lines) {
+		return fmt.Errorf("the response has no ndjson line %d, found %d lines", line, len(lines))
+	}
+
+	actual, ok := lookupPath(lines[line-1], jsonQueryPath)
+	if !ok {
+		return fmt.Errorf("'%s' not found in ndjson line %d", jsonQueryPath, line)
+	}
+
+	value = s.ReplaceValues(value)
+	if fmt.Sprint(actual) != value {
+		return fmt.Errorf("the json query path %s in ndjson line %d is %v, expected %s", jsonQueryPath, line, actual, value)
 	}
 
-	s.store[value] = val.ChildNodes()[index].Value()
 	return nil
 }
 
-func (s *ServerFeature) GetNodeFromResponse(queryPath string) (*jsonquery.Node, error) {
-	doc, err := jsonquery.Parse(strings.NewReader(s.responseBody))
-	if err != nil {
-		return nil, err
+func (s *ServerFeature) ndjsonLines() ([]interface{}, error) {
+	var lines []interface{}
+	for i, line := range strings.Split(s.responseBody, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(line), &parsed); err != nil {
+			return nil, fmt.Errorf("line %d of the response is not valid json: %v", i+1, err)
+		}
+		lines = append(lines, parsed)
 	}
 
-	queryPath = strings.ReplaceAll(queryPath, ".", "/")
+	return lines, nil
+}
 
-	extractedValue := jsonquery.FindOne(doc, fmt.Sprintf("//%s", queryPath))
-	if extractedValue == nil {
-		return nil, fmt.Errorf("'%s' not found in response: %s", queryPath, PrettifyJSON(s.responseBody))
+func (s *ServerFeature) TheResponseShouldEqualJSON(body *godog.DocString) error {
+	var expected interface{}
+	if err := json.Unmarshal([]byte(s.ReplaceValues(body.Content)), &expected); err != nil {
+		return fmt.Errorf("expected body is not valid json: %v", err)
 	}
 
-	return extractedValue, nil
+	var actual interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &actual); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	if diffs := diffJSON("", expected, actual, 0); len(diffs) > 0 {
+		return fmt.Errorf("response does not equal the expected json:\n%s\ngot %s", strings.Join(diffs, "\n"), PrettifyJSON(s.responseBody))
+	}
+
+	return nil
 }
 
-func (s *ServerFeature) TheResponseShouldNotContainA(key string) error {
-	res, err := json.Marshal(s.responseBody)
-	if err != nil {
-		return fmt.Errorf("failed to marshal response: %v", err)
+func (s *ServerFeature) TheResponseShouldEqualThePreviousResponse() error {
+	var previous interface{}
+	if err := json.Unmarshal([]byte(s.previousResponseBody), &previous); err != nil {
+		return fmt.Errorf("failed to unmarshal previous response: %v", err)
 	}
 
-	actual := common.CleanString(string(res))
-	if strings.Contains(actual, key) {
-		return fmt.Errorf("response contains %s, got %s", key, actual)
+	var actual interface{}
+	if err := json.Unmarshal([]byte(s.responseBody), &actual); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	if diffs := diffJSON("", previous, actual, 0); len(diffs) > 0 {
+		return fmt.Errorf("response does not equal the previous response:\n%s", strings.Join(diffs, "\n"))
 	}
 
 	return nil
 }
 
-func (s *ServerFeature) TheResponseShouldMatchJSON(body *godog.DocString) error {
-	if s.responseBody == "" {
-		return fmt.Errorf("response is empty")
-	} else if !strings.Contains(s.responseBody, body.Content) {
-		return fmt.Errorf("response does not match %s, got %s", body.Content, s.responseBody)
+func (s *ServerFeature) TheResponseShouldMatchGoldenFile(path string) error {
+	path = s.ReplaceValues(path)
+
+	if viper.GetBool("update") {
+		log.Info().Msgf("updating golden file %s", path)
+		return s.WriteResponseToFile(path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read golden file %s: %v", path, err)
+	}
+
+	var expected interface{}
+	if err = json.Unmarshal(content, &expected); err != nil {
+		return fmt.Errorf("golden file %s is not valid json: %v", path, err)
+	}
+
+	var actual interface{}
+	if err = json.Unmarshal([]byte(s.responseBody), &actual); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %v", err)
+	}
+
+	if diffs := diffJSON("", expected, actual, 0); len(diffs) > 0 {
+		return fmt.Errorf("response does not match golden file %s:\n%s", path, strings.Join(diffs, "\n"))
 	}
 
 	return nil
@@ -495,49 +3476,187 @@ func (s *ServerFeature) Do(req *http.Request) error {
 		return fmt.Errorf("request is nil")
 	}
 
-	req.URL = s.FormatURL(req.URL.String())
+	s.prepareRequest(req)
 
-	if s.authResponse.Token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.authResponse.Token))
-	}
-
-	if req.Body != nil {
-		body, _ := io.ReadAll(req.Body)
-		replacedBody := s.PrepareBody(string(body))
-		req.Body = io.NopCloser(replacedBody)
-		req.Header.Set("Content-Type", "application/json")
-		log.Info().Msgf("POST REQUEST BODY: %s", replacedBody)
+	response, err := s.send(req)
+	s.client.CheckRedirect = nil
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
 	}
+	defer response.Body.Close()
 
-	response, err := s.client.Do(req)
+	reader, err := responseBodyReader(response)
 	if err != nil {
-		return fmt.Errorf("failed to make request: %v", err)
+		return fmt.Errorf("failed to decompress response body: %v", err)
 	}
 
-	responseBody, err := io.ReadAll(response.Body)
+	responseBody, err := io.ReadAll(reader)
 	if err != nil {
 		return fmt.Errorf("failed to read response body: %v", err)
 	}
 
-	log.Info().
+	s.recordResponse(req, response, responseBody)
+	return nil
+}
+
+// responseBodyReader decompresses gzip-encoded response bodies, leaving empty
+// ones such as those of 204, 304 and HEAD responses as they are.
+func responseBodyReader(response *http.Response) (io.Reader, error) {
+	if !strings.EqualFold(response.Header.Get("Content-Encoding"), "gzip") {
+		return response.Body, nil
+	}
+
+	body := bufio.NewReader(response.Body)
+	if _, err := body.Peek(1); err == io.EOF {
+		return body, nil
+	}
+
+	return gzip.NewReader(body)
+}
+
+func (s *ServerFeature) send(req *http.Request) (*http.Response, error) {
+	retries := 0
+	if viper.GetBool("retry_all_methods") || isIdempotent(req.Method) {
+		retries = viper.GetInt("max_retries")
+	}
+	backoff := viper.GetDuration("retry_backoff")
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		response, err := s.client.Do(req)
+		s.responseDuration = time.Since(start)
+		if err == nil || attempt >= retries {
+			return response, err
+		}
+
+		log.Debug().Err(err).Msgf("retrying %s %s in %s (attempt %d of %d)", req.Method, req.URL, backoff, attempt+1, retries)
+		time.Sleep(backoff)
+		backoff *= 2
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	return slices.Contains([]string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete}, method)
+}
+
+func (s *ServerFeature) bodyLog() *zerolog.Event {
+	switch {
+	case s.quiet:
+		return nil
+	case s.verbose:
+		return log.WithLevel(zerolog.NoLevel)
+	default:
+		return log.Info()
+	}
+}
+
+func (s *ServerFeature) recordResponse(req *http.Request, response *http.Response, responseBody []byte) {
+	s.bodyLog().
 		Str("response", PrettifyJSON(string(responseBody))).
 		Msg("HTTP RESPONSE BODY")
 
 	s.httpResponse = response
+	s.previousResponseBody = s.responseBody
 	s.responseBody = string(responseBody)
 
+	if req.Method == http.MethodPost && response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices {
+		s.createdBodies = append(s.createdBodies, s.responseBody)
+	}
+
+	s.response = common.Response{}
 	if len(s.responseBody) > 0 {
 		_ = json.Unmarshal([]byte(s.responseBody), &s.response)
 	}
+}
 
-	return nil
+func (s *ServerFeature) prepareRequest(req *http.Request) {
+	req.URL = s.FormatURL(s.replaceURLValues(req.URL))
+
+	if s.authResponse.Token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.authResponse.Token))
+	} else if s.username != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+
+	requestIDHeader := viper.GetString("request_id_header")
+	if requestIDHeader != "" && req.Header.Get(requestIDHeader) == "" {
+		req.Header.Set(requestIDHeader, fmt.Sprintf("%016x", rand.Uint64()))
+	}
+
+	s.lastRequest = sentRequest{method: req.Method, url: req.URL.String(), requestID: req.Header.Get(requestIDHeader)}
+
+	if req.Body != nil {
+		if req.Header.Get("Content-Type") == "" {
+			contentType := s.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		replacedBody := string(body)
+		raw := req.Header.Get("Content-Encoding") != "" || !isTextContentType(req.Header.Get("Content-Type"))
+		if !raw {
+			replacedBody = s.ReplaceValues(replacedBody)
+		}
+		s.lastRequest.body = replacedBody
+
+		req.ContentLength = int64(len(replacedBody))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(replacedBody)), nil
+		}
+		req.Body, _ = req.GetBody()
+		if replacedBody == "" {
+			req.Body = http.NoBody
+		}
+		if raw {
+			s.bodyLog().Msgf("POST REQUEST BODY: %d bytes", len(replacedBody))
+		} else {
+			s.bodyLog().Msgf("POST REQUEST BODY: %s", s.redactPasswords(s.lastRequest.body))
+		}
+	}
+
+	for name, value := range s.defaultHeaders {
+		if req.Header.Get(name) == "" {
+			req.Header.Set(name, s.ReplaceValues(value))
+		}
+	}
+
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	s.lastRequest.header = req.Header.Clone()
 }
 
-func PrettifyJSON(s string) string {
-	s = strings.ReplaceAll(s, "\n", "")
-	s = strings.ReplaceAll(s, "  ", " ")
-	s = strings.TrimSpace(s)
+func isTextContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
 
+	return slices.Contains([]string{"application/json", "application/x-ndjson", "application/xml", "application/x-www-form-urlencoded", "application/javascript"}, mediaType)
+}
+
+func PrettifyJSON(s string) string {
 	var prettyJSON bytes.Buffer
 	if err := json.Indent(&prettyJSON, []byte(s), "", "  "); err != nil {
 		return s
@@ -552,48 +3671,101 @@ func (s *ServerFeature) ReplaceValues(input string) string {
 	}
 	input = strings.ReplaceAll(input, "${random_id}", fmt.Sprint(rand.Intn(10000000)))
 	input = strings.ReplaceAll(input, "${today}", time.Now().Format(time.DateOnly))
+	for token, generate := range randomTokens {
+		for strings.Contains(input, token) {
+			input = strings.Replace(input, token, generate(), 1)
+		}
+	}
+	input = envPattern.ReplaceAllStringFunc(input, func(token string) string {
+		name := envPattern.FindStringSubmatch(token)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			log.Warn().Msgf("environment variable %s is not set", name)
+		}
+		return value
+	})
 
-	found := false
-	for strings.Contains(input, "${") {
-		for k, v := range s.store {
+	for range len(s.store) + 1 {
+		replaced := storePattern.ReplaceAllStringFunc(input, s.resolveStoreToken)
+		if replaced == input {
+			break
+		}
+		input = replaced
+	}
 
-			if strings.Contains(input, fmt.Sprintf("${%s}", k)) {
-				input = strings.ReplaceAll(input, fmt.Sprintf("${%s}", k), fmt.Sprint(v))
-				found = true
+	return input
+}
 
-			} else if strings.Contains(input, fmt.Sprintf("${%s.", k)) {
-				start := strings.Index(input, fmt.Sprintf("${%s.", k))
-				if start == -1 {
-					break
-				}
+func (s *ServerFeature) resolveStoreToken(token string) string {
+	key := storePattern.FindStringSubmatch(token)[1]
 
-				end := strings.Index(input[start:], "}")
-				if end == -1 {
-					break
-				}
+	name, escape := strings.CutPrefix(key, "urlencode:")
+	value, ok := s.storedValue(name)
+	if !ok {
+		return token
+	}
 
-				key := input[start+len(k)+3 : start+end]
-				val, ok := v.(map[string]interface{})[key]
-				if !ok {
-					break
-				}
+	if escape {
+		return url.PathEscape(value)
+	}
 
-				input = fmt.Sprintf("%s%s%s", input[:start], val, input[start+end+1:])
-				found = true
-				break
-			}
+	return value
+}
 
-		}
+func (s *ServerFeature) storedValue(key string) (string, bool) {
+	if v, ok := s.store[key]; ok {
+		return fmt.Sprint(v), true
+	}
 
-		if !found {
-			break
+	root, path, nested := strings.Cut(key, ".")
+	if !nested {
+		return "", false
+	}
+
+	v, ok := s.store[root]
+	if !ok {
+		return "", false
+	}
+
+	val, ok := lookupPath(v, path)
+	if !ok {
+		log.Warn().Msgf("saved %s has no value at %s", root, path)
+		return "", false
+	}
+
+	return fmt.Sprint(val), true
+}
+
+// replaceURLValues substitutes values in a request URL, undoing the escaping
+// url.Parse applies to the braces of its ${key} tokens first.
+func (s *ServerFeature) replaceURLValues(u *url.URL) string {
+	endpoint := u.String()
+	if u.Scheme == "" && u.Host == "" {
+		endpoint = u.EscapedPath()
+		if u.RawQuery != "" {
+			endpoint += "?" + u.RawQuery
 		}
 	}
 
-	return input
+	endpoint = escapedStorePattern.ReplaceAllStringFunc(endpoint, func(token string) string {
+		key, err := url.PathUnescape(escapedStorePattern.FindStringSubmatch(token)[1])
+		if err != nil {
+			return token
+		}
+		return "${" + key + "}"
+	})
+
+	return s.ReplaceValues(endpoint)
 }
 
 func (s *ServerFeature) FormatURL(endpoint string) (baseURL *url.URL) {
+	ref, err := url.Parse(endpoint)
+	if err != nil {
+		ref = &url.URL{Path: endpoint}
+	} else if ref.Scheme == "http" || ref.Scheme == "https" {
+		return ref
+	}
+
 	appDomain := viper.GetString("appDomain")
 
 	scheme := "http"
@@ -610,49 +3782,305 @@ func (s *ServerFeature) FormatURL(endpoint string) (baseURL *url.URL) {
 		}
 	}
 
+	basePath := ""
+	if configured, ok := viper.GetStringMapString("lifecycle_urls")[lifecycle]; ok {
+		if lifecycleURL, err := url.Parse(configured); err != nil || lifecycleURL.Host == "" {
+			log.Warn().Msgf("ignoring invalid lifecycle url %q for %s", configured, lifecycle)
+		} else {
+			scheme, domain, basePath = lifecycleURL.Scheme, lifecycleURL.Host, strings.Trim(lifecycleURL.Path, "/")
+		}
+	}
+
+	prefix := viper.GetString("api_prefix")
+	if s.apiPrefix != nil {
+		prefix = *s.apiPrefix
+	}
+	if prefix = strings.Trim(prefix, "/"); basePath != "" {
+		prefix = strings.Trim(basePath+"/"+prefix, "/")
+	}
+
+	path := "/" + strings.TrimPrefix(ref.Path, "/")
+	rawPath := "/" + strings.TrimPrefix(ref.EscapedPath(), "/")
+	if prefix != "" {
+		path = "/" + prefix + path
+		rawPath = "/" + prefix + rawPath
+	}
+
 	return &url.URL{
-		Scheme: scheme,
-		Host:   domain,
-		Path:   "/api/" + endpoint,
+		Scheme:   scheme,
+		Host:     domain,
+		Path:     path,
+		RawPath:  rawPath,
+		RawQuery: ref.RawQuery,
+	}
+}
+
+func InitializeTestSuite(ctx *godog.TestSuiteContext) {
+	ctx.AfterSuite(func() {
+		if err := CleanupCreatedResources(); err != nil {
+			log.Error().Err(err).Msg("failed to clean up created resources")
+		}
+	})
+}
+
+func CleanupCreatedResources() error {
+	createdResourcesMu.Lock()
+	resources := createdResources
+	createdResources = nil
+	createdResourcesMu.Unlock()
+
+	client := newHTTPClient()
+
+	var errs []error
+	for _, resource := range slices.Backward(resources) {
+		req, err := http.NewRequest(http.MethodDelete, resource.url, nil)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create request for %s: %v", resource.url, err))
+			continue
+		}
+		req.Header = resource.header.Clone()
+
+		response, err := client.Do(req)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %s: %v", resource.url, err))
+			continue
+		}
+		response.Body.Close()
+
+		if response.StatusCode >= http.StatusBadRequest && response.StatusCode != http.StatusNotFound {
+			errs = append(errs, fmt.Errorf("failed to delete %s, got %d", resource.url, response.StatusCode))
+		}
 	}
+
+	return errors.Join(errs...)
 }
 
 func InitializeScenario(ctx *godog.ScenarioContext) {
-	api := &ServerFeature{client: http.DefaultClient}
+	(&ServerFeature{}).InitializeScenario(ctx)
+}
+
+func (s *ServerFeature) attachLastExchange(ctx context.Context) context.Context {
+	var request strings.Builder
+	fmt.Fprintf(&request, "%s %s\n", s.lastRequest.method, s.lastRequest.url)
+	header := s.lastRequest.header.Clone()
+	for name := range header {
+		if isAuthHeader(name) {
+			header.Set(name, "[redacted]")
+		}
+	}
+	_ = header.Write(&request)
+	if s.lastRequest.body != "" {
+		fmt.Fprintf(&request, "\n%s\n", s.redactPasswords(s.lastRequest.body))
+	}
+
+	log.Error().
+		Str("request", request.String()).
+		Str("response", PrettifyJSON(s.responseBody)).
+		Msg("SCENARIO FAILED")
+
+	mediaType := "text/plain"
+	if json.Valid([]byte(s.responseBody)) {
+		mediaType = "application/json"
+	}
+
+	return godog.Attach(ctx,
+		godog.Attachment{FileName: "request.txt", MediaType: "text/plain", Body: []byte(request.String())},
+		godog.Attachment{FileName: "response", MediaType: mediaType, Body: []byte(s.responseBody)},
+	)
+}
+
+func newHTTPClient() *http.Client {
+	if !viper.GetBool("insecure_skip_verify") {
+		return &http.Client{}
+	}
+
+	if viper.GetString("lifecycle") == "prod" {
+		log.Warn().Msg("insecure_skip_verify is ignored in prod")
+		return &http.Client{}
+	}
+
+	log.Warn().Msg("TLS certificate verification is disabled")
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+
+	return &http.Client{Transport: transport}
+}
+
+func (s *ServerFeature) InitializeScenario(ctx *godog.ScenarioContext) {
+	api := &ServerFeature{client: newHTTPClient(), db: s.db, defaultHeaders: s.defaultHeaders, seed: s.seed, cleanup: s.cleanup}
 
 	ctx.Before(func(ctx context.Context, sc *godog.Scenario) (context.Context, error) {
 		api.reset(sc)
+		if api.seed != nil {
+			if err := api.seed(ctx); err != nil {
+				return ctx, fmt.Errorf("failed to seed scenario: %v", err)
+			}
+		}
+		return ctx, nil
+	})
+
+	ctx.After(func(ctx context.Context, sc *godog.Scenario, err error) (context.Context, error) {
+		if err != nil && api.lastRequest.method != "" && !api.quiet {
+			ctx = api.attachLastExchange(ctx)
+		}
+		return ctx, nil
+	})
+
+	ctx.After(func(ctx context.Context, sc *godog.Scenario, _ error) (context.Context, error) {
+		if api.cleanup != nil {
+			if err := api.cleanup(ctx); err != nil {
+				return ctx, fmt.Errorf("failed to clean up scenario: %v", err)
+			}
+		}
 		return ctx, nil
 	})
 
-	ctx.Step(`^I send "(GET|POST|DELETE)" request to "([^"]*)"$`, api.SendRequest)
-	ctx.Step(`^I send "(PATCH|POST|PUT)" request to "([^"]*)" with data$`, api.SendRequestWithData)
+	ctx.Step(`^the "([^"]*)" environment is healthy$`, api.TheEnvironmentShouldBeHealthy)
+
+	ctx.Step(`^I follow redirects$`, api.FollowRedirects)
+	ctx.Step(`^I do not follow redirects$`, api.DoNotFollowRedirects)
+	ctx.Step(`^I set header "([^"]*)" to "([^"]*)"$`, api.SetHeader)
+	ctx.Step(`^I set the following headers$`, api.SetHeaders)
+	ctx.Step(`^I set content type to "([^"]*)"$`, api.SetContentType)
+	ctx.Step(`^I clear all headers$`, api.ClearHeaders)
+	ctx.Step(`^I authenticate with username "([^"]*)" and password "([^"]*)"$`, api.AuthenticateWithBasicAuth)
+	ctx.Step(`^I am logged in as "([^"]*)"$`, api.LogInAs)
+	ctx.Step(`^the current user id should be "([^"]*)"$`, api.TheCurrentUserIDShouldBe)
+	ctx.Step(`^I obtain a token from "([^"]*)" with client "([^"]*)" and secret "([^"]*)"$`, api.ObtainClientCredentialsToken)
+
+	ctx.Step(`^I send "(GET|POST|PUT|PATCH|DELETE)" request to "([^"]*)"$`, api.SendRequest)
+	ctx.Step(`^I send "(POST|PUT|PATCH|DELETE)" request to "([^"]*)" with data$`, api.SendRequestWithData)
+	ctx.Step(`^I send "(POST|PUT)" request to "([^"]*)" with gzipped data$`, api.SendGzippedData)
 	ctx.Step(`^I send "(GET|POST|PUT|PATCH|DELETE)" request to "([^"]*)" with params$`, api.SendRequestWithParams)
+	ctx.Step(`^I send "(POST|PUT|PATCH)" request to "([^"]*)" with params and data$`, api.SendRequestWithParamsAndData)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with "([^"]*)" of size (\d+)$`, api.SendArrayOfSize)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with "([^"]*)" of size (\d+) from template$`, api.SendArrayOfSizeFromTemplate)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with empty body$`, api.SendEmptyBody)
+	ctx.Step(`^I send "(POST|PUT|PATCH)" request to "([^"]*)" with form data$`, api.SendRequestWithForm)
+	ctx.Step(`^I send "(POST|PUT|PATCH)" request to "([^"]*)" with body from file "([^"]*)"$`, api.SendBodyFromFile)
+	ctx.Step(`^I upload file "([^"]*)" as "([^"]*)" to "([^"]*)"$`, api.UploadFile)
+	ctx.Step(`^I upload file "([^"]*)" as "([^"]*)" to "([^"]*)" with fields$`, api.UploadFileWithFields)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with saved "([^"]*)"$`, api.SendSavedBodyAs)
+	ctx.Step(`^I send "([^"]*)" request to "([^"]*)" with content type "([^"]*)" and data$`, api.SendWithContentType)
+	ctx.Step(`^I send "(POST|PUT|PATCH|DELETE)" request to "([^"]*)" with xml$`, api.SendXMLRequest)
+	ctx.Step(`^I send graphql query to "([^"]*)"$`, api.SendGraphQLQuery)
+	ctx.Step(`^I resend the last request$`, api.ResendLastRequest)
+	ctx.Step(`^if the response code was (\d+), I send "(GET)" request to "([^"]*)"$`, api.SendRequestIfResponseCodeWas)
+	ctx.Step(`^I wait for (\d+)ms$`, api.Wait)
+	ctx.Step(`^I retry "(GET)" request to "([^"]*)" until response code is (\d+) within (\d+)s$`, api.RetryRequestUntil)
+	ctx.Step(`^I follow the "([^"]*)" link with "(GET|POST|PUT|PATCH|DELETE)"$`, api.FollowResponseLink)
+	ctx.Step(`^I send "([^"]*)" streaming request to "([^"]*)"(?: for (\d+) seconds)?$`, api.SendStreamingRequest)
+	ctx.Step(`^I send a range request to "([^"]*)" for "([^"]*)"$`, api.SendRangeRequest)
 
 	ctx.Step(`^the response code should be (\d+)$`, api.TheResponseCodeShouldBe)
 	ctx.Step(`^the response should not be empty$`, api.TheResponseShouldNotBeEmpty)
+	ctx.Step(`^the response body should be smaller than (\d+) bytes$`, api.TheResponseBodySizeShouldBeLessThan)
+	ctx.Step(`^the response body should be larger than (\d+) bytes$`, api.TheResponseBodySizeShouldBeGreaterThan)
+	ctx.Step(`^the response time should be less than (\d+)ms$`, api.TheResponseTimeShouldBeLessThan)
+	ctx.Step(`^the response should stream at least (\d+) lines within (\d+) seconds$`, api.TheResponseShouldStreamAtLeast)
+	ctx.Step(`^the response should be partial content$`, api.TheResponseShouldBePartialContent)
+	ctx.Step(`^the response header "([^"]*)" should be "([^"]*)"$`, api.TheResponseHeaderShouldBe)
+	ctx.Step(`^the response should have header "([^"]*)"$`, api.TheResponseShouldHaveHeader)
+	ctx.Step(`^the response content type should be "([^"]*)"$`, api.TheResponseContentTypeShouldBe)
+	ctx.Step(`^the response should redirect to "([^"]*)"$`, api.TheResponseShouldRedirectTo)
+	ctx.Step(`^the response ETag should match the body hash$`, api.TheResponseETagShouldMatchBodyHash)
+	ctx.Step(`^the response should set cookie "([^"]*)"$`, api.TheResponseShouldSetCookie)
+	ctx.Step(`^the response should not be cacheable$`, api.TheResponseShouldNotBeCacheable)
+	ctx.Step(`^the response should echo the request id$`, api.TheResponseShouldEchoRequestID)
+	ctx.Step(`^the server time should be within (\d+) seconds$`, api.TheServerTimeShouldBeWithin)
+	ctx.Step(`^the response "([^"]*)" should increment by one after "([^"]*)" request to "([^"]*)"$`, api.TheFieldShouldIncrementByOne)
+	ctx.Step(`^the response should round trip through "([^"]*)" ignoring "([^"]*)"$`, api.TheResponseShouldRoundTrip)
+	ctx.Step(`^the list at "([^"]*)" should be in creation order by "([^"]*)"$`, api.TheListShouldBeInCreationOrder)
+	ctx.Step(`^the list at "([^"]*)" should be in reverse creation order by "([^"]*)"$`, api.TheListShouldBeInReverseCreationOrder)
+	ctx.Step(`^patching "([^"]*)" should only change "([^"]*)"$`, api.PatchShouldOnlyChange)
+	ctx.Step(`^a resource created at "([^"]*)" should be findable at "([^"]*)" by "([^"]*)"$`, api.CreatedResourceShouldBeFindableBy)
+	ctx.Step(`^concurrent updates to "([^"]*)" should converge "([^"]*)" to one of "([^"]*)"$`, api.ConcurrentUpdatesShouldConverge)
+	ctx.Step(`^the following routes should require authentication$`, api.ProtectedRoutesRequireAuth)
+	ctx.Step(`^"([^"]*)" requests to "([^"]*)" and "([^"]*)" should take the same time within (\d+)ms$`, api.ResponseTimesShouldBeConsistent)
+	ctx.Step(`^"([^"]*)" request to "([^"]*)" with param "([^"]*)" set to "([^"]*)" should not change "([^"]*)"$`, api.AddingParamShouldNotChangeResults)
+	ctx.Step(`^sending "([^"]*)" request to "([^"]*)" as plain text should be rejected$`, api.TheServerShouldRejectPlainText)
+	ctx.Step(`^the following requests should return consistent errors$`, api.ErrorsShouldBeConsistent)
+	ctx.Step(`^the rate limit for "([^"]*)" request to "([^"]*)" should reset and allow requests$`, api.TheRateLimitShouldResetAndAllowRequests)
 
 	ctx.Step(`^the response should match json$`, api.TheResponseShouldMatchJSON)
+	ctx.Step(`^the response should equal json$`, api.TheResponseShouldEqualJSON)
+	ctx.Step(`^the response should match golden file "([^"]*)"$`, api.TheResponseShouldMatchGoldenFile)
+	ctx.Step(`^the response should equal the previous response$`, api.TheResponseShouldEqualThePreviousResponse)
+	ctx.Step(`^the response xml "([^"]*)" should be "([^"]*)"$`, api.TheResponseXMLShouldBe)
+	ctx.Step(`^the graphql response should not have errors$`, api.TheGraphQLResponseShouldNotHaveErrors)
+	ctx.Step(`^the response error message should be "([^"]*)"$`, api.TheResponseErrorMessageShouldBe)
+	ctx.Step(`^the response error message should contain "([^"]*)"$`, api.TheResponseErrorMessageShouldContain)
+	ctx.Step(`^the response should be a json array$`, api.TheResponseShouldBeAJSONArray)
+	ctx.Step(`^the response should be a json object$`, api.TheResponseShouldBeAJSONObject)
 	ctx.Step(`^the response should contain$`, api.TheResponseShouldContain)
 	ctx.Step(`^the response should contain a "([^"]*)"$`, api.TheResponseShouldContainA)
 	ctx.Step(`^the response should contain a "([^"]*)" that contains items$`, api.TheResponseShouldContainAWithItems)
+	ctx.Step(`^the response "([^"]*)" should equal unordered$`, api.TheResponseShouldEqualUnordered)
 	ctx.Step(`^the response should not contain a "([^"]*)"$`, api.TheResponseShouldNotContainA)
+	ctx.Step(`^the response should not contain path "([^"]*)"$`, api.TheResponseShouldNotContainPath)
+	ctx.Step(`^the response should have a "([^"]*)" link$`, api.TheResponseShouldHaveLink)
+	ctx.Step(`^the response should be JSON:API$`, api.TheResponseShouldBeJSONAPI)
+	ctx.Step(`^the JSON:API resource type should be "([^"]*)"$`, api.TheJSONAPIResourceTypeShouldBe)
+	ctx.Step(`^the response should only contain fields "([^"]*)"$`, api.TheResponseShouldOnlyContainFields)
+	ctx.Step(`^the response should have exactly keys "([^"]*)"$`, api.TheResponseShouldHaveExactlyKeys)
 	ctx.Step(`^the response should contain a$`, api.TheResponseShouldContainA)
 
 	ctx.Step(`^the response should contain a "([^"]*)" set to "([^"]*)"$`, api.TheResponseShouldContainSetTo)
 	ctx.Step(`^the response should contain a "([^"]*)" temporally equal to "([^"]*)"$`, api.TheResponseShouldContainATimeSetTo)
+	ctx.Step(`^the response "([^"]*)" should be within (\d+)s of now$`, api.TheResponseShouldBeWithinSecondsOfNow)
+	ctx.Step(`^the response "([^"]*)" should match the database value$`, api.TheResponseFieldShouldMatchSQL)
+	ctx.Step(`^the response "([^"]*)" should match regex "([^"]*)"$`, api.TheResponseFieldShouldMatchRegex)
+	ctx.Step(`^the response "([^"]*)" should be true$`, api.TheResponseShouldBeTrue)
+	ctx.Step(`^the response "([^"]*)" should be false$`, api.TheResponseShouldBeFalse)
+	ctx.Step(`^the response "([^"]*)" should be of type "(string|number|boolean|array|object|null)"$`, api.TheResponseShouldBeOfType)
+	ctx.Step(`^the response "([^"]*)" should be a signed url$`, api.TheResponseFieldShouldBeASignedURL)
+	ctx.Step(`^the signed url in "([^"]*)" should be fetchable$`, api.TheSignedURLShouldBeFetchable)
+	ctx.Step(`^the response "([^"]*)" should equal the request "([^"]*)"$`, api.TheResponseFieldShouldEqualRequestField)
+	ctx.Step(`^the response "([^"]*)" should equal the (lowercase|uppercase|trimmed|slugified) request "([^"]*)"$`, api.TheResponseFieldShouldEqualTransformedRequestField)
+	ctx.Step(`^the response "([^"]*)" should be greater than (\d+(?:\.\d+)?)$`, api.TheResponseShouldBeGreaterThan)
+	ctx.Step(`^the response "([^"]*)" should be less than (\d+(?:\.\d+)?)$`, api.TheResponseShouldBeLessThan)
+	ctx.Step(`^the response "([^"]*)" should be at least (\d+(?:\.\d+)?)$`, api.TheResponseShouldBeAtLeast)
+	ctx.Step(`^the response "([^"]*)" should be at most (\d+(?:\.\d+)?)$`, api.TheResponseShouldBeAtMost)
+	ctx.Step(`^the response "([^"]*)" should be approximately (\d+(?:\.\d+)?) within (\d+(?:\.\d+)?)$`, api.TheResponseShouldBeApproximately)
+	ctx.Step(`^the response "([^"]*)" should meet the "([^"]*)" sla$`, api.TheResponseFieldShouldMeetSLA)
+	ctx.Step(`^the response "([^"]*)" should be a valid "([^"]*)" enum$`, api.TheResponseFieldShouldBeValidEnum)
+	ctx.Step(`^the response "([^"]*)" should be one of "([^"]*)"$`, api.TheResponseShouldBeOneOf)
+	ctx.Step(`^the response "([^"]*)" should be a jwt with claim "([^"]*)" set to "([^"]*)"$`, api.TheResponseShouldBeAJWTWithClaim)
+	ctx.Step(`^the response "([^"]*)" should not be less than the baseline in "([^"]*)"$`, api.TheFieldShouldNotBeLessThanBaseline)
+	ctx.Step(`^the response "([^"]*)" should match the baseline in "([^"]*)" within (\d+(?:\.\d+)?)%$`, api.TheResponseShouldMatchBaselineWithinPercent)
 	ctx.Step(`^the response should contain an item at index (\d+) with "([^"]*)" set to "([^"]*)"$`, api.TheResponseContainsItemAtIndexWithPropertySetTo)
 	ctx.Step(`^the response should contain an item with "([^"]*)" set to "([^"]*)"$`, api.TheResponseContainsItemWithPropertySetTo)
+	ctx.Step(`^the response should contain (\d+) items in "([^"]*)" where "([^"]*)" is "([^"]*)"$`, api.TheResponseShouldContainNItemsWhere)
+	ctx.Step(`^the response "([^"]*)" field "([^"]*)" should have (\d+) distinct values$`, api.TheArrayFieldShouldHaveNDistinctValues)
+	ctx.Step(`^the response "([^"]*)" should be sorted ascending by "([^"]*)"$`, api.TheResponseShouldBeSortedAscendingBy)
+	ctx.Step(`^the response "([^"]*)" should be sorted descending by "([^"]*)"$`, api.TheResponseShouldBeSortedDescendingBy)
+	ctx.Step(`^the response "([^"]*)" should not contain items from saved "([^"]*)" by "([^"]*)"$`, api.TheResponseArrayShouldNotContainSavedItems)
 
 	ctx.Step(`^the response should contain a "([^"]*)" that is null$`, api.TheResponseShouldContainAThatIsNull)
 	ctx.Step(`^the response should contain a "([^"]*)" that is not null$`, api.TheResponseShouldContainAThatIsNotNull)
 
+	ctx.Step(`^the response "([^"]*)" should be expanded$`, api.TheResponseShouldHaveExpanded)
+	ctx.Step(`^the response "([^"]*)" should not be expanded$`, api.TheResponseShouldNotHaveExpanded)
+
 	ctx.Step(`^the response should contain a "([^"]*)" that is empty$`, api.TheResponseShouldContainAThatIsEmpty)
 	ctx.Step(`^the response should contain a "([^"]*)" that is not empty$`, api.TheResponseShouldContainAThatIsNotEmpty)
 
 	ctx.Step(`^the response should have a length of (\d+)$`, api.TheResponseHaveLength)
+	ctx.Step(`^the "([^"]*)" header should equal the response length$`, api.TheHeaderShouldEqualTheResponseLength)
+	ctx.Step(`^the response hash should be "([^"]*)"$`, api.TheResponseHashShouldBe)
+	ctx.Step(`^the response depth should be at most (\d+)$`, api.TheResponseDepthShouldBeAtMost)
 	ctx.Step(`^the response should contain a "([^"]*)" with length (\d+)$`, api.TheResponseShouldContainAWithLength)
+	ctx.Step(`^the response should have (\d+) ndjson lines$`, api.TheResponseShouldHaveNDJSONLines)
+	ctx.Step(`^ndjson line (\d+) should contain "([^"]*)" set to "([^"]*)"$`, api.TheNDJSONLineShouldContainSetTo)
 
 	ctx.Step(`^I save "([^"]*)" from the response`, api.SaveValueFromResponse)
+	ctx.Step(`^I save the response as "([^"]*)"$`, api.SaveResponseAs)
 	ctx.Step(`^I save the item at index (\d+) in "([^"]*)" as "([^"]*)"$`, api.SaveValueFromResponseList)
+	ctx.Step(`^I save header "([^"]*)" as "([^"]*)"$`, api.SaveHeaderFromResponse)
+	ctx.Step(`^I save the response hash as "([^"]*)"$`, api.SaveResponseHash)
+	ctx.Step(`^I write the response to file "([^"]*)"$`, api.WriteResponseToFile)
+	ctx.Step(`^I register the created resource for cleanup$`, api.RegisterCreatedResourceForCleanup)
+	ctx.Step(`^I save the response "([^"]*)" as a baseline in "([^"]*)"$`, api.SaveFieldToPersistentBaseline)
+	ctx.Step(`^I set saved "([^"]*)" field "([^"]*)" to "([^"]*)"$`, api.SetSavedFieldTo)
 }